@@ -2,11 +2,22 @@ package pyroscope
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"runtime"
 	"runtime/pprof"
 	"time"
 
+	"github.com/grafana/pyroscope-go/godeltaprof"
+	"github.com/grafana/pyroscope-go/internal/logging"
+	"github.com/grafana/pyroscope-go/metrics"
+	"github.com/grafana/pyroscope-go/resource"
+	"github.com/grafana/pyroscope-go/upstream"
+	"github.com/grafana/pyroscope-go/upstream/fanout"
+	"github.com/grafana/pyroscope-go/upstream/push"
 	"github.com/grafana/pyroscope-go/upstream/remote"
 )
 
@@ -19,10 +30,102 @@ type Config struct {
 	TenantID          string // specify TenantId when using phlare multi-tenancy
 	UploadRate        time.Duration
 	Logger            Logger
+	SlogLogger        *slog.Logger // used instead of Logger if set, see NewSlogLogger
 	ProfileTypes      []ProfileType
 	DisableGCRuns     bool // this will disable automatic runtime.GC runs between getting the heap profiles
 	HTTPHeaders       map[string]string
 	HTTPClient        remote.HTTPClient
+	Retry             remote.RetryConfig // retries of failed uploads, disabled by default
+	Spool             remote.SpoolConfig // on-disk spool of profiles that could not be uploaded, disabled by default
+	// ContentEncoding, if set to "gzip" or "zstd", compresses the bodies of
+	// the /ingest requests, with the matching Content-Encoding header. If
+	// every destination sets it, and no custom Upstream is used, the heap,
+	// mutex, block and goroutine profiles are collected uncompressed, so
+	// that they are not compressed twice. Otherwise, gzip-compressed
+	// profiles are sent as is. If the server responds with 415 Unsupported
+	// Media Type, the profiles are sent gzip-compressed without the encoding.
+	ContentEncoding string
+	// UsePushAPI enables sending profiles via the Pyroscope push API
+	// (push.v1.PusherService/Push) instead of the legacy /ingest endpoint.
+	// Retry and Spool only apply to the /ingest endpoint.
+	UsePushAPI bool
+	// Destinations lists servers profiles are sent to in addition to
+	// ServerAddress, which may be left empty if destinations are specified.
+	// Each destination has its own upload queue, so a slow or failing
+	// destination does not affect the others. The destinations are ignored
+	// if the PYROSCOPE_ADHOC_SERVER_ADDRESS environment variable is set.
+	Destinations []Destination
+	// Upstream, if set, receives the profiles instead of the servers
+	// specified with ServerAddress and Destinations. If the upstream
+	// implements upstream.Lifecycle, it is started and stopped along
+	// with the profiler. The PYROSCOPE_ADHOC_SERVER_ADDRESS environment
+	// variable takes precedence over the option.
+	Upstream upstream.Upstream
+	// MutexProfileFraction, BlockProfileRate and MemProfileRate, if not
+	// zero, are applied to the runtime by Start and restored by Stop; see
+	// runtime.SetMutexProfileFraction, runtime.SetBlockProfileRate and
+	// runtime.MemProfileRate. Mutex and block profiles are empty unless
+	// the corresponding rate is set. The block profile rate is restored
+	// to the value previously set by Start, or to zero, as the runtime
+	// does not expose it. MemProfileRate should be set as early as possible
+	// in the program execution.
+	MutexProfileFraction int
+	BlockProfileRate     int
+	MemProfileRate       int
+	// Metrics receives the metrics the profiler reports about itself,
+	// such as upload durations and dropped profiles. See the metrics
+	// package for the list. Metrics are not reported by default.
+	Metrics metrics.Metrics
+	// ResourceDetectors detect attributes of the environment, such as the
+	// Kubernetes pod name or the application version, which are added to
+	// Tags. Tags specified explicitly take precedence. Use
+	// resource.Default() for all the detectors available.
+	ResourceDetectors []resource.Detector
+	// LabelLimits limits the number of distinct label values in CPU, wall
+	// and goroutine profiles, protecting the server from labels of high
+	// cardinality, such as user or request IDs. No limits by default.
+	LabelLimits LabelLimits
+	// SplitCPUProfileBy lists pprof label keys, such as "tenant", the CPU
+	// profile is split by: samples with distinct values of the labels are
+	// uploaded as separate series, with the labels added to the series
+	// labels, which makes queries by these labels cheaper. The keys should
+	// be of low cardinality, as each combination of values is uploaded as
+	// a separate profile. Start fails if a perf_event CPUProfiler is used,
+	// as it does not record labels.
+	SplitCPUProfileBy []string
+	// SampleRate is the CPU profiling rate in samples per second, 100 by
+	// default. Lower rates reduce the profiling overhead, higher rates give
+	// more precise profiles of short runs. The rate is set with
+	// runtime.SetCPUProfileRate, which makes the runtime print a "cannot set
+	// cpu profile rate" warning to stderr every upload period, if the rate
+	// differs from the default one: the warning cannot be suppressed, and is
+	// explained once in the log when the profiler starts. The perf_event CPU
+	// profilers, see CPUProfiler, sample at the rate without the warning.
+	// The rate also applies to the CPU profiles collected with
+	// http/pprof.Profile while the profiler is running.
+	SampleRate uint32
+	// CPUProfiler selects how CPU profiles are collected: with runtime/pprof,
+	// by default, or, on Linux, with perf_event software clock events, which
+	// sample all the threads of the process at the configured rate, including
+	// short bursts of activity that SIGPROF based profiling under-samples.
+	// The perf_event profilers do not record pprof labels, so they can not
+	// be used with SplitCPUProfileBy or the span profiles of x/otel, and
+	// they fall back to runtime/pprof if perf events are not permitted, for
+	// example by kernel.perf_event_paranoid or seccomp.
+	CPUProfiler CPUProfiler
+	// HeapGC limits the garbage collections forced to get up-to-date heap
+	// profiles in the upload windows without a GC cycle, for example to
+	// avoid latency spikes of collecting large heaps. By default, a GC is
+	// forced in every such window, unless DisableGCRuns is set. The heap
+	// profiles of the windows without a GC cycle are uploaded with the
+	// stale="true" label.
+	HeapGC HeapGCPolicy
+	// GoroutineStateLabels labels the goroutine profiles with the state of
+	// the goroutines and the duration they have been waiting for, such as
+	// state="chan receive" and wait="10m+". The states are read from a
+	// runtime.Stack traceback of all goroutines, which stops the world and
+	// takes about as long as the goroutine profile itself. Disabled by default.
+	GoroutineStateLabels bool
 
 	// Deprecated: the field will be removed in future releases.
 	// Use BasicAuthUser and BasicAuthPassword instead.
@@ -33,14 +136,28 @@ type Config struct {
 	// Deprecated: the field will be removed in future releases.
 	// DisableCumulativeMerge is ignored.
 	DisableCumulativeMerge bool
-	// Deprecated: the field will be removed in future releases.
-	// SampleRate is set to 100 and is not configurable.
-	SampleRate uint32
+}
+
+// Destination describes a server profiles are sent to.
+type Destination struct {
+	ServerAddress     string // e.g http://pyroscope.services.internal:4040
+	BasicAuthUser     string // http basic auth user
+	BasicAuthPassword string // http basic auth password
+	TenantID          string // specify TenantId when using phlare multi-tenancy
+	HTTPHeaders       map[string]string
+	HTTPClient        remote.HTTPClient
+	Retry             remote.RetryConfig // retries of failed uploads, disabled by default
+	Spool             remote.SpoolConfig // must not be shared with other destinations
+	UsePushAPI        bool               // see Config.UsePushAPI
+	ContentEncoding   string             // see Config.ContentEncoding
+
+	authToken string
 }
 
 type Profiler struct {
 	session  *Session
-	uploader *remote.Remote
+	uploader upstream.Upstream
+	rates    *runtimeRates
 }
 
 // Start starts continuously profiling go code
@@ -48,31 +165,30 @@ func Start(cfg Config) (*Profiler, error) {
 	if len(cfg.ProfileTypes) == 0 {
 		cfg.ProfileTypes = DefaultProfileTypes
 	}
+	if cfg.SlogLogger != nil {
+		cfg.Logger = NewSlogLogger(cfg.SlogLogger)
+	}
 	if cfg.Logger == nil {
 		cfg.Logger = noopLogger
 	}
+	if len(cfg.ResourceDetectors) > 0 {
+		cfg.Tags = resourceTags(cfg)
+	}
 
 	// Override the address to use when the environment variable is defined.
 	// This is useful to support adhoc push ingestion.
 	if address, ok := os.LookupEnv("PYROSCOPE_ADHOC_SERVER_ADDRESS"); ok {
 		cfg.ServerAddress = address
+		cfg.Destinations = nil
+		cfg.Upstream = nil
 	}
 
-	rc := remote.Config{
-		AuthToken:         cfg.AuthToken,
-		TenantID:          cfg.TenantID,
-		BasicAuthUser:     cfg.BasicAuthUser,
-		BasicAuthPassword: cfg.BasicAuthPassword,
-		HTTPHeaders:       cfg.HTTPHeaders,
-		HTTPClient:        cfg.HTTPClient,
-		Address:           cfg.ServerAddress,
-		Threads:           5, // per each profile type upload
-		Timeout:           30 * time.Second,
-		Logger:            cfg.Logger,
-	}
-	uploader, err := remote.NewRemote(rc)
-	if err != nil {
-		return nil, err
+	uploader := cfg.Upstream
+	if uploader == nil {
+		var err error
+		if uploader, err = newUploader(cfg); err != nil {
+			return nil, err
+		}
 	}
 
 	sc := SessionConfig{
@@ -84,28 +200,197 @@ func Start(cfg Config) (*Profiler, error) {
 		DisableGCRuns:          cfg.DisableGCRuns,
 		DisableAutomaticResets: cfg.DisableAutomaticResets,
 		UploadRate:             cfg.UploadRate,
+		Metrics:                cfg.Metrics,
+		LabelLimits:            cfg.LabelLimits,
+		SplitCPUProfileBy:      cfg.SplitCPUProfileBy,
+		SampleRate:             cfg.SampleRate,
+		CPUProfiler:            cfg.CPUProfiler,
+		HeapGC:                 cfg.HeapGC,
+		GoroutineStateLabels:   cfg.GoroutineStateLabels,
+	}
+	if cfg.Upstream == nil && encodesBodies(uploadDestinations(cfg)) {
+		sc.ProfileCompression = godeltaprof.CompressionNone
 	}
 
+	rates := setRuntimeRates(cfg)
 	s, err := NewSession(sc)
 	if err != nil {
+		rates.restore()
+
 		return nil, fmt.Errorf("new session: %w", err)
 	}
-	uploader.Start()
+	l, ok := uploader.(upstream.Lifecycle)
+	if ok {
+		l.Start()
+	}
 	if err = s.Start(); err != nil {
+		if ok {
+			l.Stop()
+		}
+		rates.restore()
+
 		return nil, fmt.Errorf("start session: %w", err)
 	}
 
-	return &Profiler{session: s, uploader: uploader}, nil
+	return &Profiler{session: s, uploader: uploader, rates: rates}, nil
+}
+
+// resourceTags returns the tags merged with the detected resource attributes.
+func resourceTags(cfg Config) map[string]string {
+	tags, err := resource.Detect(cfg.ResourceDetectors...)
+	if err != nil {
+		logging.New(cfg.Logger).Warn("failed to detect resource attributes", "err", err)
+	}
+	for k, v := range cfg.Tags {
+		tags[k] = v
+	}
+
+	return tags
+}
+
+var errSharedSpoolDir = errors.New("spool directory is shared by several destinations")
+
+func newUploader(cfg Config) (upstream.Upstream, error) {
+	destinations := uploadDestinations(cfg)
+	spoolDirs := make(map[string]struct{}, len(destinations))
+	for _, d := range destinations {
+		if d.Spool.Dir == "" {
+			continue
+		}
+		dir := filepath.Clean(d.Spool.Dir)
+		if _, ok := spoolDirs[dir]; ok {
+			return nil, fmt.Errorf("%w: %s", errSharedSpoolDir, dir)
+		}
+		spoolDirs[dir] = struct{}{}
+	}
+	if len(destinations) == 1 {
+		return newDestinationUploader(destinations[0], cfg.Logger, cfg.Metrics)
+	}
+	uploaders := make([]upstream.Upstream, 0, len(destinations))
+	for _, d := range destinations {
+		u, err := newDestinationUploader(d, cfg.Logger, cfg.Metrics)
+		if err != nil {
+			return nil, fmt.Errorf("destination %s: %w", d.ServerAddress, err)
+		}
+		uploaders = append(uploaders, u)
+	}
+
+	return fanout.NewFanout(uploaders...), nil
+}
+
+// uploadDestinations returns the destinations of the profiles,
+// including the one configured with Config.ServerAddress.
+func uploadDestinations(cfg Config) []Destination {
+	destinations := cfg.Destinations
+	if cfg.ServerAddress != "" || len(destinations) == 0 {
+		destinations = append([]Destination{{
+			ServerAddress:     cfg.ServerAddress,
+			BasicAuthUser:     cfg.BasicAuthUser,
+			BasicAuthPassword: cfg.BasicAuthPassword,
+			TenantID:          cfg.TenantID,
+			HTTPHeaders:       cfg.HTTPHeaders,
+			HTTPClient:        cfg.HTTPClient,
+			Retry:             cfg.Retry,
+			Spool:             cfg.Spool,
+			UsePushAPI:        cfg.UsePushAPI,
+			ContentEncoding:   cfg.ContentEncoding,
+			authToken:         cfg.AuthToken,
+		}}, destinations...)
+	}
+
+	return destinations
+}
+
+// encodesBodies reports whether every destination compresses the request
+// bodies, so that the profiles need not be compressed beforehand.
+func encodesBodies(destinations []Destination) bool {
+	for _, d := range destinations {
+		if d.UsePushAPI || d.ContentEncoding == "" {
+			return false
+		}
+	}
+
+	return len(destinations) > 0
+}
+
+func newDestinationUploader(d Destination, logger Logger, m metrics.Metrics) (upstream.Upstream, error) {
+	if d.UsePushAPI {
+		return push.NewPusher(push.Config{
+			TenantID:          d.TenantID,
+			BasicAuthUser:     d.BasicAuthUser,
+			BasicAuthPassword: d.BasicAuthPassword,
+			HTTPHeaders:       d.HTTPHeaders,
+			HTTPClient:        d.HTTPClient,
+			Address:           d.ServerAddress,
+			Threads:           5,
+			Timeout:           30 * time.Second,
+			Logger:            logger,
+			Metrics:           m,
+		})
+	}
+
+	return remote.NewRemote(remote.Config{
+		AuthToken:         d.authToken,
+		TenantID:          d.TenantID,
+		BasicAuthUser:     d.BasicAuthUser,
+		BasicAuthPassword: d.BasicAuthPassword,
+		HTTPHeaders:       d.HTTPHeaders,
+		HTTPClient:        d.HTTPClient,
+		Address:           d.ServerAddress,
+		Threads:           5, // per each profile type upload
+		Timeout:           30 * time.Second,
+		Logger:            logger,
+		Retry:             d.Retry,
+		Spool:             d.Spool,
+		Metrics:           m,
+		ContentEncoding:   d.ContentEncoding,
+	})
 }
 
 // Stop stops continuous profiling session and uploads the remaining profiling data
 func (p *Profiler) Stop() error {
 	p.session.Stop()
-	p.uploader.Stop()
+	if l, ok := p.uploader.(upstream.Lifecycle); ok {
+		l.Stop()
+	}
+	p.rates.restore()
 
 	return nil
 }
 
+// Reconfigure changes the configuration of the running profiler without
+// restarting it: profile types can be enabled or disabled, and the upload
+// rate and tags can be changed. Profiles collected so far are uploaded
+// with the previous configuration. Zero UploadRate and empty ProfileTypes
+// are replaced with defaults, as in Start. Non-zero MutexProfileFraction
+// and BlockProfileRate are applied to the runtime, and restored by Stop;
+// they are left unchanged if Reconfigure fails.
+func (p *Profiler) Reconfigure(c RuntimeConfig) error {
+	if len(c.ProfileTypes) == 0 {
+		c.ProfileTypes = DefaultProfileTypes
+	}
+	// The rates are applied first: the session warns about
+	// enabled profile types with zero rates.
+	undo := p.rates.update(c.MutexProfileFraction, c.BlockProfileRate)
+	if err := p.session.Reconfigure(c); err != nil {
+		undo()
+
+		return err
+	}
+
+	return nil
+}
+
+// RuntimeConfig returns the current configuration of the profiler,
+// which can be modified and passed to Reconfigure.
+func (p *Profiler) RuntimeConfig() RuntimeConfig {
+	c := p.session.RuntimeConfig()
+	c.MutexProfileFraction = runtime.SetMutexProfileFraction(-1)
+	c.BlockProfileRate = int(blockProfileRate.Load())
+
+	return c
+}
+
 // Flush resets current profiling session. if wait is true, also waits for all profiles to be uploaded synchronously
 func (p *Profiler) Flush(wait bool) {
 	p.session.flush(wait)
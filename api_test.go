@@ -1,9 +1,33 @@
 package pyroscope
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/pyroscope-go/internal/logging"
+	internal "github.com/grafana/pyroscope-go/internal/pprof"
+	"github.com/grafana/pyroscope-go/internal/testutil"
+	"github.com/grafana/pyroscope-go/metrics"
+	"github.com/grafana/pyroscope-go/resource"
+	"github.com/grafana/pyroscope-go/upstream"
+	"github.com/grafana/pyroscope-go/upstream/remote"
 )
 
 func TestProfilerStartStop(t *testing.T) {
@@ -14,3 +38,699 @@ func TestProfilerStartStop(t *testing.T) {
 	err = profiler.Stop()
 	require.NoError(t, err)
 }
+
+func TestProfilerContentEncoding(t *testing.T) {
+	profiles := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "zstd" {
+			return
+		}
+		zr, err := zstd.NewReader(r.Body)
+		if err != nil {
+			return
+		}
+		defer zr.Close()
+		r.Body = io.NopCloser(zr)
+		if f, _, err := r.FormFile("profile"); err == nil {
+			b, _ := io.ReadAll(f)
+			profiles <- b
+		}
+	}))
+	defer server.Close()
+
+	profiler, err := Start(Config{
+		ApplicationName: "test",
+		ProfileTypes:    []ProfileType{ProfileGoroutines},
+		ServerAddress:   server.URL,
+		ContentEncoding: "zstd",
+	})
+	require.NoError(t, err)
+	profiler.Flush(true)
+	require.NoError(t, profiler.Stop())
+
+	require.Len(t, profiles, 1, "no profile uploaded with zstd content encoding")
+	profile := <-profiles
+	require.NotEmpty(t, profile)
+	// The profile is not compressed twice.
+	require.False(t, bytes.HasPrefix(profile, []byte{0x1f, 0x8b}))
+}
+
+func TestProfilerMixedContentEncoding(t *testing.T) {
+	profiles := make(chan []byte, 2)
+	handler := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "" {
+			return
+		}
+		if f, _, err := r.FormFile("profile"); err == nil {
+			b, _ := io.ReadAll(f)
+			profiles <- b
+		}
+	})
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	encoded := httptest.NewServer(handler)
+	defer encoded.Close()
+
+	profiler, err := Start(Config{
+		ApplicationName: "test",
+		ProfileTypes:    []ProfileType{ProfileGoroutines},
+		Destinations: []Destination{
+			{ServerAddress: plain.URL},
+			{ServerAddress: encoded.URL, ContentEncoding: "zstd"},
+		},
+	})
+	require.NoError(t, err)
+	profiler.Flush(true)
+	require.NoError(t, profiler.Stop())
+
+	// Both destinations get the gzip-compressed profile, which is not compressed twice.
+	require.Len(t, profiles, 2)
+	for range 2 {
+		require.True(t, bytes.HasPrefix(<-profiles, []byte{0x1f, 0x8b}))
+	}
+}
+
+// TestProfilerFlushWithoutCPU checks that Flush does not wait for the CPU
+// collector if it is not running: its events are only read while it runs.
+func TestProfilerFlushWithoutCPU(t *testing.T) {
+	profiler, err := Start(Config{
+		ApplicationName: "test",
+		ProfileTypes:    []ProfileType{ProfileGoroutines},
+		Upstream:        new(lifecycleUpstream),
+	})
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		profiler.Flush(true)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		// Stop would block as well.
+		t.Fatal("Flush blocked on the stopped CPU collector")
+	}
+	require.NoError(t, profiler.Stop())
+}
+
+func TestProfilerAdhocServerAddress(t *testing.T) {
+	var adhoc, destination atomic.Int32
+	adhocServer := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		adhoc.Add(1)
+	}))
+	defer adhocServer.Close()
+	destinationServer := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		destination.Add(1)
+	}))
+	defer destinationServer.Close()
+	t.Setenv("PYROSCOPE_ADHOC_SERVER_ADDRESS", adhocServer.URL)
+
+	profiler, err := Start(Config{
+		ApplicationName: "test",
+		ProfileTypes:    []ProfileType{ProfileGoroutines},
+		Destinations:    []Destination{{ServerAddress: destinationServer.URL}},
+	})
+	require.NoError(t, err)
+	profiler.Flush(true)
+	require.NoError(t, profiler.Stop())
+
+	require.Equal(t, int32(1), adhoc.Load())
+	require.Equal(t, int32(0), destination.Load())
+}
+
+func TestProfilerDestinations(t *testing.T) {
+	var failed, succeeded atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		failed.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Scope-OrgID") == "tenant" {
+			succeeded.Add(1)
+		}
+	}))
+	defer working.Close()
+
+	profiler, err := Start(Config{
+		ApplicationName: "test",
+		ProfileTypes:    []ProfileType{ProfileGoroutines},
+		Destinations: []Destination{
+			{ServerAddress: failing.URL},
+			{ServerAddress: working.URL, TenantID: "tenant"},
+		},
+	})
+	require.NoError(t, err)
+	profiler.Flush(true)
+	require.NoError(t, profiler.Stop())
+
+	require.Equal(t, int32(1), failed.Load())
+	require.Equal(t, int32(1), succeeded.Load())
+}
+
+func TestProfilerSharedSpoolDir(t *testing.T) {
+	dir := t.TempDir()
+	_, err := Start(Config{
+		ApplicationName: "test",
+		ServerAddress:   "http://localhost:4040",
+		Spool:           remote.SpoolConfig{Dir: dir},
+		Destinations: []Destination{
+			{ServerAddress: "http://localhost:4041", Spool: remote.SpoolConfig{Dir: dir + "/"}},
+		},
+	})
+	require.ErrorIs(t, err, errSharedSpoolDir)
+}
+
+func TestProfilerCustomUpstream(t *testing.T) {
+	u := new(lifecycleUpstream)
+	profiler, err := Start(Config{
+		ApplicationName: "test",
+		ProfileTypes:    []ProfileType{ProfileGoroutines},
+		Upstream:        u,
+	})
+	require.NoError(t, err)
+	require.True(t, u.started)
+	profiler.Flush(true)
+	require.NoError(t, profiler.Stop())
+	require.True(t, u.stopped)
+
+	jobs := u.jobs()
+	require.Len(t, jobs, 1)
+	require.Equal(t, upstream.ProfileNameGoroutine, jobs[0].ProfileName)
+	require.Equal(t, "test", jobs[0].Labels["__name__"])
+}
+
+func TestProfilerReconfigure(t *testing.T) {
+	u := new(lifecycleUpstream)
+	profiler, err := Start(Config{
+		ApplicationName: "test",
+		ProfileTypes:    []ProfileType{ProfileGoroutines},
+		Tags:            map[string]string{"env": "dev"},
+		Upstream:        u,
+	})
+	require.NoError(t, err)
+
+	rc := profiler.RuntimeConfig()
+	require.Equal(t, []ProfileType{ProfileGoroutines}, rc.ProfileTypes)
+	rc.ProfileTypes = []ProfileType{ProfileCPU, ProfileInuseSpace}
+	rc.Tags = map[string]string{"env": "prod"}
+	require.NoError(t, profiler.Reconfigure(rc))
+	require.Equal(t, rc, profiler.RuntimeConfig())
+	// The profiler does not share the tags with the caller.
+	profiler.RuntimeConfig().Tags["env"] = "test"
+	rc.Tags["env"] = "test"
+	require.Equal(t, "prod", profiler.RuntimeConfig().Tags["env"])
+	rc.Tags["env"] = "prod"
+
+	// The window collected before reconfiguration is uploaded
+	// with the previous configuration.
+	jobs := u.jobs()
+	require.Len(t, jobs, 1)
+	require.Equal(t, upstream.ProfileNameGoroutine, jobs[0].ProfileName)
+	require.Equal(t, "dev", jobs[0].Labels["env"])
+
+	profiler.Flush(true)
+	require.NoError(t, profiler.Stop())
+	names := make(map[string]string)
+	for _, j := range u.jobs()[1:] {
+		names[j.ProfileName] = j.Labels["env"]
+	}
+	require.Equal(t, map[string]string{
+		upstream.ProfileNameCPU:    "prod",
+		upstream.ProfileNameMemory: "prod",
+	}, names)
+
+	require.Error(t, profiler.Reconfigure(rc))
+}
+
+// TestProfilerReconfigureWithoutCPU checks that Flush does not wait
+// for the CPU collector stopped with Reconfigure.
+func TestProfilerReconfigureWithoutCPU(t *testing.T) {
+	profiler, err := Start(Config{
+		ApplicationName: "test",
+		ProfileTypes:    []ProfileType{ProfileCPU, ProfileGoroutines},
+		Upstream:        new(lifecycleUpstream),
+	})
+	require.NoError(t, err)
+	rc := profiler.RuntimeConfig()
+	rc.ProfileTypes = []ProfileType{ProfileGoroutines}
+	require.NoError(t, profiler.Reconfigure(rc))
+
+	done := make(chan struct{})
+	go func() {
+		profiler.Flush(true)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		// Stop would block as well.
+		t.Fatal("Flush blocked on the stopped CPU collector")
+	}
+	require.NoError(t, profiler.Stop())
+}
+
+func TestProfilerRuntimeRates(t *testing.T) {
+	prevMutex := runtime.SetMutexProfileFraction(0)
+	prevMem := runtime.MemProfileRate
+	defer func() {
+		runtime.SetMutexProfileFraction(prevMutex)
+		runtime.MemProfileRate = prevMem
+	}()
+
+	logger := testutil.NewTestLogger()
+	profiler, err := Start(Config{
+		ApplicationName: "test",
+		ProfileTypes:    []ProfileType{ProfileMutexCount, ProfileInuseSpace},
+		Upstream:        new(lifecycleUpstream),
+		Logger:          logger,
+		MemProfileRate:  1024,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1024, runtime.MemProfileRate)
+	require.NoError(t, profiler.Stop())
+	require.Equal(t, prevMem, runtime.MemProfileRate)
+	require.True(t, slices.ContainsFunc(logger.Lines(), func(l string) bool {
+		return strings.HasPrefix(l, "mutex profiling is enabled, but the mutex profile fraction is zero")
+	}))
+
+	logger = testutil.NewTestLogger()
+	profiler, err = Start(Config{
+		ApplicationName:      "test",
+		ProfileTypes:         []ProfileType{ProfileMutexCount, ProfileBlockCount},
+		Upstream:             new(lifecycleUpstream),
+		Logger:               logger,
+		MutexProfileFraction: 5,
+		BlockProfileRate:     1000,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 5, runtime.SetMutexProfileFraction(-1))
+	require.NoError(t, profiler.Stop())
+	require.Equal(t, 0, runtime.SetMutexProfileFraction(-1))
+	require.Equal(t, int64(0), blockProfileRate.Load())
+	for _, l := range logger.Lines() {
+		require.NotContains(t, l, "profiling is enabled, but")
+	}
+}
+
+func TestProfilerReconfigureRuntimeRates(t *testing.T) {
+	prevMutex := runtime.SetMutexProfileFraction(0)
+	defer runtime.SetMutexProfileFraction(prevMutex)
+
+	logger := testutil.NewTestLogger()
+	profiler, err := Start(Config{
+		ApplicationName: "test",
+		ProfileTypes:    []ProfileType{ProfileGoroutines},
+		Upstream:        new(lifecycleUpstream),
+		Logger:          logger,
+	})
+	require.NoError(t, err)
+
+	zeroRateWarnings := func() int {
+		n := 0
+		for _, l := range logger.Lines() {
+			if strings.HasPrefix(l, "mutex profiling is enabled, but the mutex profile fraction is zero") {
+				n++
+			}
+		}
+
+		return n
+	}
+	rc := profiler.RuntimeConfig()
+	rc.ProfileTypes = []ProfileType{ProfileGoroutines, ProfileMutexCount}
+	require.NoError(t, profiler.Reconfigure(rc))
+	require.Equal(t, 1, zeroRateWarnings())
+
+	rc.ProfileTypes = []ProfileType{ProfileMutexCount, ProfileBlockCount}
+	rc.MutexProfileFraction = 5
+	rc.BlockProfileRate = 1000
+	require.NoError(t, profiler.Reconfigure(rc))
+	require.Equal(t, 5, runtime.SetMutexProfileFraction(-1))
+	require.Equal(t, rc, profiler.RuntimeConfig())
+	require.Equal(t, 1, zeroRateWarnings())
+
+	require.NoError(t, profiler.Stop())
+	require.Equal(t, 0, runtime.SetMutexProfileFraction(-1))
+	require.Equal(t, int64(0), blockProfileRate.Load())
+	// The rates are not changed if the profiler cannot be reconfigured.
+	rc.MutexProfileFraction = 7
+	rc.BlockProfileRate = 500
+	require.Error(t, profiler.Reconfigure(rc))
+	require.Equal(t, 0, runtime.SetMutexProfileFraction(-1))
+	require.Equal(t, int64(0), blockProfileRate.Load())
+
+}
+
+func TestProfilerMetrics(t *testing.T) {
+	m := testutil.NewTestMetrics()
+	profiler, err := Start(Config{
+		ApplicationName: "test",
+		ProfileTypes:    []ProfileType{ProfileInuseSpace, ProfileGoroutines},
+		Upstream:        new(lifecycleUpstream),
+		Metrics:         m,
+	})
+	require.NoError(t, err)
+	profiler.Flush(true)
+	require.NoError(t, profiler.Stop())
+
+	for _, name := range []string{upstream.ProfileNameMemory, upstream.ProfileNameGoroutine} {
+		require.Len(t, m.Values(metrics.CollectDuration.Name, name), 1)
+		size := m.Values(metrics.ProfileSize.Name, name)
+		require.Len(t, size, 1)
+		require.Positive(t, size[0])
+	}
+}
+
+func TestProfilerResourceDetectors(t *testing.T) {
+	u := new(lifecycleUpstream)
+	detector := resource.DetectorFunc(func() (map[string]string, error) {
+		return map[string]string{"k8s.pod.name": "my-app", "env": "detected"}, nil
+	})
+	profiler, err := Start(Config{
+		ApplicationName:   "test",
+		ProfileTypes:      []ProfileType{ProfileGoroutines},
+		Tags:              map[string]string{"env": "prod"},
+		Upstream:          u,
+		ResourceDetectors: []resource.Detector{detector},
+	})
+	require.NoError(t, err)
+	profiler.Flush(true)
+	require.NoError(t, profiler.Stop())
+
+	jobs := u.jobs()
+	require.Len(t, jobs, 1)
+	require.Equal(t, "my-app", jobs[0].Labels["k8s.pod.name"])
+	require.Equal(t, "prod", jobs[0].Labels["env"])
+}
+
+func TestProfilerLabelLimits(t *testing.T) {
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range 3 {
+		wg.Add(1)
+		go pprof.Do(context.Background(), pprof.Labels("request_id", strconv.Itoa(i)), func(context.Context) {
+			wg.Done()
+			<-stop
+		})
+	}
+	wg.Wait()
+	defer close(stop)
+
+	u := new(lifecycleUpstream)
+	logger := testutil.NewTestLogger()
+	profiler, err := Start(Config{
+		ApplicationName: "test",
+		ProfileTypes:    []ProfileType{ProfileGoroutines},
+		Upstream:        u,
+		Logger:          logger,
+		LabelLimits:     LabelLimits{MaxValuesPerKey: 1},
+	})
+	require.NoError(t, err)
+	profiler.Flush(true)
+	require.NoError(t, profiler.Stop())
+
+	jobs := u.jobs()
+	require.Len(t, jobs, 1)
+	r, err := gzip.NewReader(bytes.NewReader(jobs[0].Profile))
+	require.NoError(t, err)
+	profile, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Contains(t, string(profile), "__other__")
+	require.Contains(t, strings.Join(logger.Lines(), "\n"), "key=request_id")
+}
+
+func TestLabelGuardUpstreamCopiesJob(t *testing.T) {
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range 2 {
+		wg.Add(1)
+		go pprof.Do(context.Background(), pprof.Labels("request_id", strconv.Itoa(i)), func(context.Context) {
+			wg.Done()
+			<-stop
+		})
+	}
+	wg.Wait()
+	defer close(stop)
+	var buf bytes.Buffer
+	require.NoError(t, pprof.Lookup("goroutine").WriteTo(&buf, 0))
+
+	u := new(lifecycleUpstream)
+	guard := newLabelGuardUpstream(u, LabelLimits{MaxValuesPerKey: 1}, logging.New(nil))
+	j := &upstream.UploadJob{ProfileName: upstream.ProfileNameGoroutine, Profile: buf.Bytes()}
+	guard.Upload(j)
+
+	jobs := u.jobs()
+	require.Len(t, jobs, 1)
+	require.NotSame(t, j, jobs[0])
+	require.NotEqual(t, buf.Bytes(), jobs[0].Profile)
+	require.Equal(t, buf.Bytes(), j.Profile, "the uploaded job must not be modified")
+}
+
+func TestProfilerSplitCPUProfile(t *testing.T) {
+	u := new(lifecycleUpstream)
+	profiler, err := Start(Config{
+		ApplicationName:   "test",
+		ProfileTypes:      []ProfileType{ProfileCPU},
+		Upstream:          u,
+		SplitCPUProfileBy: []string{"tenant"},
+	})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for _, tenant := range []string{"a", "b"} {
+		wg.Add(1)
+		go pprof.Do(context.Background(), pprof.Labels("tenant", tenant), func(context.Context) {
+			defer wg.Done()
+			for deadline := time.Now().Add(500 * time.Millisecond); time.Now().Before(deadline); {
+				_ = strconv.Itoa(len(tenant))
+			}
+		})
+	}
+	wg.Wait()
+	profiler.Flush(true)
+	require.NoError(t, profiler.Stop())
+
+	tenants := make(map[string]string)
+	for _, j := range u.jobs() {
+		require.Equal(t, upstream.ProfileNameCPU, j.ProfileName)
+		tenants[j.Labels["tenant"]] = j.Name
+	}
+	require.Contains(t, tenants, "a")
+	require.Contains(t, tenants, "b")
+	require.Contains(t, tenants["a"], "tenant=a")
+}
+
+func TestProfilerSampleRate(t *testing.T) {
+	u := new(lifecycleUpstream)
+	logger := testutil.NewTestLogger()
+	profiler, err := Start(Config{
+		ApplicationName: "test",
+		ProfileTypes:    []ProfileType{ProfileCPU},
+		Upstream:        u,
+		Logger:          logger,
+		SampleRate:      250,
+	})
+	require.NoError(t, err)
+	for deadline := time.Now().Add(100 * time.Millisecond); time.Now().Before(deadline); {
+		_ = strconv.Itoa(deadline.Nanosecond())
+	}
+	profiler.Flush(true)
+	require.NoError(t, profiler.Stop())
+
+	jobs := u.jobs()
+	require.NotEmpty(t, jobs)
+	for _, j := range jobs {
+		require.Equal(t, uint32(250), j.SampleRate)
+	}
+	// The runtime warning printed every upload period is explained once.
+	n := 0
+	for _, l := range logger.Lines() {
+		if strings.HasPrefix(l, "the CPU profile rate differs from the runtime/pprof one") {
+			n++
+		}
+	}
+	require.Equal(t, 1, n)
+}
+
+func TestProfilerPerfCPUProfiler(t *testing.T) {
+	perf, err := internal.NewPerfCollector(internal.PerfTaskClock, DefaultSampleRate)
+	if err != nil {
+		t.Skipf("perf events are not permitted: %v", err)
+	}
+
+	u := new(lifecycleUpstream)
+	logger := testutil.NewTestLogger()
+	profiler, err := Start(Config{
+		ApplicationName: "test",
+		ProfileTypes:    []ProfileType{ProfileCPU},
+		Upstream:        u,
+		Logger:          logger,
+		CPUProfiler:     CPUProfilerPerfTaskClock,
+	})
+	require.NoError(t, err)
+	require.IsType(t, perf, profiler.session.cpuCollector)
+	for deadline := time.Now().Add(100 * time.Millisecond); time.Now().Before(deadline); {
+		_ = strconv.Itoa(deadline.Nanosecond())
+	}
+	profiler.Flush(true)
+	require.NoError(t, profiler.Stop())
+
+	jobs := u.jobs()
+	require.NotEmpty(t, jobs)
+	for _, j := range jobs {
+		require.Equal(t, upstream.ProfileNameCPU, j.ProfileName)
+		require.NotEmpty(t, j.Profile)
+	}
+	require.True(t, slices.ContainsFunc(logger.Lines(), func(l string) bool {
+		return strings.HasPrefix(l, "perf_event CPU profiles do not record pprof labels")
+	}))
+}
+
+func TestProfilerPerfCPUProfilerFallback(t *testing.T) {
+	if _, err := internal.NewPerfCollector(internal.PerfTaskClock, DefaultSampleRate); err == nil {
+		t.Skip("perf events are permitted")
+	}
+
+	u := new(lifecycleUpstream)
+	logger := testutil.NewTestLogger()
+	profiler, err := Start(Config{
+		ApplicationName: "test",
+		ProfileTypes:    []ProfileType{ProfileCPU},
+		Upstream:        u,
+		Logger:          logger,
+		CPUProfiler:     CPUProfilerPerfTaskClock,
+	})
+	require.NoError(t, err)
+	require.Equal(t, internal.RateCollector(DefaultSampleRate), profiler.session.cpuCollector)
+	profiler.Flush(true)
+	require.NoError(t, profiler.Stop())
+
+	require.True(t, slices.ContainsFunc(logger.Lines(), func(l string) bool {
+		return strings.HasPrefix(l, "perf events are not available, falling back to runtime/pprof CPU profiling")
+	}))
+	require.NotEmpty(t, u.jobs())
+}
+
+func TestProfilerPerfCPUProfilerSplit(t *testing.T) {
+	_, err := Start(Config{
+		ApplicationName:   "test",
+		ProfileTypes:      []ProfileType{ProfileCPU},
+		Upstream:          new(lifecycleUpstream),
+		CPUProfiler:       CPUProfilerPerfCPUClock,
+		SplitCPUProfileBy: []string{"tenant"},
+	})
+	require.ErrorIs(t, err, errPerfSplitCPUProfile)
+}
+
+func TestProfilerWall(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	go pprof.Do(context.Background(), pprof.Labels("request_id", "wall"), func(context.Context) {
+		<-stop
+	})
+
+	u := new(lifecycleUpstream)
+	profiler, err := Start(Config{
+		ApplicationName: "test",
+		ProfileTypes:    []ProfileType{ProfileWall},
+		Upstream:        u,
+	})
+	require.NoError(t, err)
+	time.Sleep(3 * wallSampleInterval)
+	profiler.Flush(true)
+	require.NoError(t, profiler.Stop())
+
+	jobs := u.jobs()
+	require.Len(t, jobs, 1)
+	require.Equal(t, upstream.ProfileNameWall, jobs[0].ProfileName)
+	r, err := gzip.NewReader(bytes.NewReader(jobs[0].Profile))
+	require.NoError(t, err)
+	profile, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Contains(t, string(profile), "request_id")
+}
+
+func TestProfilerRuntimeProfiles(t *testing.T) {
+	u := new(lifecycleUpstream)
+	profiler, err := Start(Config{
+		ApplicationName: "test",
+		ProfileTypes:    []ProfileType{ProfileThreadCreate, ProfileRuntimeMetrics},
+		Upstream:        u,
+	})
+	require.NoError(t, err)
+	runtime.GC()
+	profiler.Flush(true)
+	require.NoError(t, profiler.Stop())
+
+	jobs := u.jobs()
+	require.Len(t, jobs, 2)
+	require.Equal(t, upstream.ProfileNameThreadCreate, jobs[0].ProfileName)
+	require.Equal(t, upstream.ProfileNameRuntimeMetrics, jobs[1].ProfileName)
+	r, err := gzip.NewReader(bytes.NewReader(jobs[1].Profile))
+	require.NoError(t, err)
+	profile, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Contains(t, string(profile), "/gc/pauses:seconds")
+}
+
+func TestProfilerHeapGCPolicy(t *testing.T) {
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+	for _, tc := range []struct {
+		name   string
+		policy HeapGCPolicy
+		stale  []bool
+	}{
+		{"default", HeapGCPolicy{}, []bool{false, false, false}},
+		{"every 2 windows", HeapGCPolicy{ForceEvery: 2}, []bool{false, true, false}},
+		{"heap size limit", HeapGCPolicy{MaxHeapBytes: 1}, []bool{false, true, true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			u := new(lifecycleUpstream)
+			profiler, err := Start(Config{
+				ApplicationName: "test",
+				ProfileTypes:    []ProfileType{ProfileInuseSpace},
+				Upstream:        u,
+				HeapGC:          tc.policy,
+			})
+			require.NoError(t, err)
+			runtime.GC()
+			for range tc.stale {
+				profiler.Flush(true)
+			}
+			require.NoError(t, profiler.Stop())
+
+			jobs := u.jobs()
+			require.GreaterOrEqual(t, len(jobs), len(tc.stale))
+			for i, stale := range tc.stale {
+				_, ok := jobs[i].Labels[labelStaleHeap]
+				require.Equal(t, stale, ok, "upload %d", i)
+			}
+		})
+	}
+}
+
+type lifecycleUpstream struct {
+	sync.Mutex
+
+	uploaded []*upstream.UploadJob
+	started  bool
+	stopped  bool
+}
+
+func (u *lifecycleUpstream) Upload(j *upstream.UploadJob) {
+	u.Lock()
+	u.uploaded = append(u.uploaded, j)
+	u.Unlock()
+}
+
+func (u *lifecycleUpstream) jobs() []*upstream.UploadJob {
+	u.Lock()
+	defer u.Unlock()
+
+	return append([]*upstream.UploadJob(nil), u.uploaded...)
+}
+
+func (*lifecycleUpstream) Flush()   {}
+func (u *lifecycleUpstream) Start() { u.started = true }
+func (u *lifecycleUpstream) Stop()  { u.stopped = true }
@@ -4,19 +4,29 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"maps"
 	"time"
 
+	"github.com/grafana/pyroscope-go/internal/labelguard"
+	"github.com/grafana/pyroscope-go/internal/labelset"
+	"github.com/grafana/pyroscope-go/internal/logging"
 	internal "github.com/grafana/pyroscope-go/internal/pprof"
 	"github.com/grafana/pyroscope-go/upstream"
 )
 
 type cpuProfileCollector struct {
-	name string
-	dur  time.Duration
+	name   string
+	labels map[string]string
+	dur    time.Duration
 
 	upstream  upstream.Upstream
 	collector internal.Collector
-	logger    Logger
+	logger    *logging.Logger
+	// splitBy lists the label keys the profile
+	// is split by before the upload, if any.
+	splitBy []string
+	// sampleRate is the CPU profiling rate, in samples per second.
+	sampleRate uint32
 
 	buf         *bytes.Buffer
 	timeStarted time.Time
@@ -34,6 +44,11 @@ type event struct {
 	typ  eventType
 	done chan error
 	w    io.Writer
+
+	// reconfigureEvent
+	name   string
+	labels map[string]string
+	dur    time.Duration
 }
 
 type eventType int
@@ -42,6 +57,7 @@ const (
 	startEvent eventType = iota
 	stopEvent
 	flushEvent
+	reconfigureEvent
 )
 
 func newEvent(typ eventType) event {
@@ -63,27 +79,30 @@ func newStartEvent(w io.Writer) event {
 
 func newCPUProfileCollector(
 	name string,
+	labels map[string]string,
 	upstream upstream.Upstream,
-	logger Logger,
+	logger *logging.Logger,
 	period time.Duration,
 ) *cpuProfileCollector {
 	buf := bytes.NewBuffer(make([]byte, 0, 1<<10))
 
 	return &cpuProfileCollector{
-		name:      name,
-		dur:       period,
-		upstream:  upstream,
-		logger:    logger,
-		collector: internal.DefaultCollector(),
-		buf:       buf,
-		events:    make(chan event),
-		halt:      make(chan struct{}),
-		done:      make(chan struct{}),
+		name:       name,
+		labels:     labels,
+		dur:        period,
+		sampleRate: DefaultSampleRate,
+		upstream:   upstream,
+		logger:     logger,
+		collector:  internal.DefaultCollector(),
+		buf:        buf,
+		events:     make(chan event),
+		halt:       make(chan struct{}),
+		done:       make(chan struct{}),
 	}
 }
 
 func (c *cpuProfileCollector) Start() {
-	c.logger.Debugf("starting cpu profile collector")
+	c.logger.Debug("starting cpu profile collector")
 	// From now on, internal pprof.StartCPUProfile
 	// is handled by this collector.
 	internal.SetCollector(c)
@@ -134,6 +153,9 @@ func (c *cpuProfileCollector) Start() {
 
 		case e := <-c.events:
 			c.handleEvent(e)
+			if e.typ == reconfigureEvent {
+				t.Reset(c.dur)
+			}
 		}
 	}
 }
@@ -170,31 +192,40 @@ func (c *cpuProfileCollector) handleEvent(e event) {
 		} else {
 			err = c.reset(nil)
 		}
+
+	case reconfigureEvent:
+		if !c.started {
+			// Upload the profile collected so far with
+			// the previous configuration.
+			err = c.reset(nil)
+		}
+		c.name, c.labels, c.dur = e.name, e.labels, e.dur
 	}
 }
 
 func (c *cpuProfileCollector) Stop() {
-	c.logger.Debugf("stopping cpu profile collector")
-	// Switches back to the standard pprof collector.
+	c.logger.Debug("stopping cpu profile collector")
+	// Switches back to the standard pprof collector: c.collector may
+	// be a rate or perf collector that must not outlive the profiler.
 	// If internal pprof.StartCPUProfile is called,
 	// the function blocks until StopCPUProfile.
-	internal.SetCollector(c.collector)
+	internal.SetCollector(internal.DefaultCollector())
 	// Note that "halt" is not an event, but rather state
 	// of the collector: the channel can be read multiple
 	// times before the collector stops.
 	close(c.halt)
 	<-c.done
-	c.logger.Debugf("stopping cpu profile collector stopped")
+	c.logger.Debug("stopping cpu profile collector stopped")
 }
 
 func (c *cpuProfileCollector) StartCPUProfile(w io.Writer) error {
-	c.logger.Debugf("cpu profile collector interrupted with StartCPUProfile")
+	c.logger.Debug("cpu profile collector interrupted with StartCPUProfile")
 
 	return newStartEvent(w).send(c.events)
 }
 
 func (c *cpuProfileCollector) StopCPUProfile() {
-	c.logger.Debugf("cpu profile collector restored")
+	c.logger.Debug("cpu profile collector restored")
 	_ = newEvent(stopEvent).send(c.events)
 }
 
@@ -202,6 +233,13 @@ func (c *cpuProfileCollector) Flush() error {
 	return newEvent(flushEvent).send(c.events)
 }
 
+func (c *cpuProfileCollector) Reconfigure(name string, labels map[string]string, period time.Duration) error {
+	e := newEvent(reconfigureEvent)
+	e.name, e.labels, e.dur = name, labels, period
+
+	return e.send(c.events)
+}
+
 func (c *cpuProfileCollector) reset(w io.Writer) error {
 	c.collector.StopCPUProfile()
 	c.upload()
@@ -214,7 +252,7 @@ func (c *cpuProfileCollector) reset(w io.Writer) error {
 	c.timeStarted = time.Now()
 
 	if err := c.collector.StartCPUProfile(d); err != nil {
-		c.logger.Errorf("failed to start CPU profiling: %v", err)
+		c.logger.Error("failed to start CPU profiling", "err", err)
 		c.timeStarted = time.Time{}
 		c.buf.Reset()
 
@@ -232,18 +270,44 @@ func (c *cpuProfileCollector) upload() {
 	if len(buf) == 0 {
 		return
 	}
-	c.upstream.Upload(&upstream.UploadJob{
+	job := &upstream.UploadJob{
 		Name:            c.name,
+		ProfileName:     upstream.ProfileNameCPU,
+		Labels:          c.labels,
 		StartTime:       c.timeStarted,
 		EndTime:         time.Now(),
 		SpyName:         "gospy",
-		SampleRate:      DefaultSampleRate,
+		SampleRate:      c.sampleRate,
 		Units:           "samples",
 		AggregationType: "sum",
 		Format:          upstream.FormatPprof,
 		Profile:         copyBuf(buf),
-	})
+	}
 	c.buf.Reset()
+	if len(c.splitBy) == 0 {
+		c.upstream.Upload(job)
+
+		return
+	}
+	parts, err := labelguard.Split(job.Profile, c.splitBy)
+	if err != nil {
+		c.logger.Error("failed to split profile", "profile_type", job.ProfileName, "err", err)
+		c.upstream.Upload(job)
+
+		return
+	}
+	for _, p := range parts {
+		j := *job
+		j.Profile = p.Profile
+		if len(p.Labels) > 0 {
+			ls := labelset.New(maps.Clone(c.labels))
+			for k, v := range p.Labels {
+				ls.Add(k, v)
+			}
+			j.Name, j.Labels = ls.Normalized(), ls.Labels()
+		}
+		c.upstream.Upload(&j)
+	}
 }
 
 var (
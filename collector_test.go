@@ -7,6 +7,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/grafana/pyroscope-go/internal/logging"
+	internal "github.com/grafana/pyroscope-go/internal/pprof"
 	"github.com/grafana/pyroscope-go/internal/testutil"
 	"github.com/grafana/pyroscope-go/upstream"
 )
@@ -16,8 +18,9 @@ func Test_StartCPUProfile_interrupts_background_profiling(t *testing.T) {
 	collector := new(mockCollector)
 	c := newCPUProfileCollector(
 		"test",
+		nil,
 		new(mockUpstream),
-		logger,
+		logging.New(logger),
 		100*time.Millisecond,
 	)
 	c.collector = collector
@@ -65,8 +68,9 @@ func Test_StartCPUProfile_blocks_Stop(t *testing.T) {
 	collector := new(mockCollector)
 	c := newCPUProfileCollector(
 		"test",
+		nil,
 		new(mockUpstream),
-		logger,
+		logging.New(logger),
 		100*time.Millisecond,
 	)
 	c.collector = collector
@@ -102,6 +106,35 @@ func Test_StartCPUProfile_blocks_Stop(t *testing.T) {
 	}
 }
 
+func Test_Stop_restores_default_collector(t *testing.T) {
+	collector := new(mockCollector)
+	c := newCPUProfileCollector(
+		"test",
+		nil,
+		new(mockUpstream),
+		logging.New(testutil.NewTestLogger()),
+		100*time.Millisecond,
+	)
+	c.collector = collector
+
+	go c.Start()
+	<-collector.waitStartCPUProfile()
+	c.Stop()
+
+	// StartCPUProfile called after Stop, e.g. by net/http/pprof,
+	// must not reach the collector of the stopped profiler.
+	start := collector.waitStartCPUProfile()
+	if err := internal.StartCPUProfile(io.Discard); err != nil {
+		t.Fatal("failed to start CPU profiling")
+	}
+	internal.StopCPUProfile()
+	select {
+	case <-start:
+		t.Fatal("the collector is used after Stop")
+	default:
+	}
+}
+
 type mockCollector struct {
 	sync.Mutex
 
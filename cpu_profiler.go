@@ -0,0 +1,59 @@
+package pyroscope
+
+import (
+	"github.com/grafana/pyroscope-go/internal/logging"
+	internal "github.com/grafana/pyroscope-go/internal/pprof"
+)
+
+// CPUProfiler selects how CPU profiles are collected.
+type CPUProfiler int
+
+const (
+	// CPUProfilerRuntime collects CPU profiles with runtime/pprof,
+	// which relies on SIGPROF signals.
+	CPUProfilerRuntime CPUProfiler = iota
+	// CPUProfilerPerfCPUClock samples the stacks of the threads with the
+	// Linux perf_event cpu-clock software event.
+	CPUProfilerPerfCPUClock
+	// CPUProfilerPerfTaskClock samples the stacks of the threads with the
+	// Linux perf_event task-clock software event.
+	CPUProfilerPerfTaskClock
+)
+
+// newCPUCollector returns the collector of the CPU profiles. The perf_event
+// profilers fall back to runtime/pprof if perf events are not permitted.
+func newCPUCollector(profiler CPUProfiler, sampleRate uint32, logger *logging.Logger) internal.Collector {
+	var clock internal.PerfClock
+	switch profiler {
+	case CPUProfilerPerfCPUClock:
+		clock = internal.PerfCPUClock
+	case CPUProfilerPerfTaskClock:
+		clock = internal.PerfTaskClock
+	default:
+		return newRuntimeCPUCollector(sampleRate, logger)
+	}
+	c, err := internal.NewPerfCollector(clock, int(sampleRate))
+	if err != nil {
+		logger.Warn("perf events are not available, falling back to runtime/pprof CPU profiling", "err", err)
+
+		return newRuntimeCPUCollector(sampleRate, logger)
+	}
+	logger.Warn("perf_event CPU profiles do not record pprof labels: " +
+		"the CPU samples are not labeled, including with the span IDs of x/otel")
+
+	return c
+}
+
+// newRuntimeCPUCollector returns the runtime/pprof collector. The runtime
+// warning printed on every start with a custom rate cannot be suppressed,
+// it is explained once instead.
+func newRuntimeCPUCollector(sampleRate uint32, logger *logging.Logger) internal.Collector {
+	if sampleRate != 0 && sampleRate != DefaultSampleRate {
+		logger.Warn("the CPU profile rate differs from the runtime/pprof one: the runtime prints "+
+			"\"cannot set cpu profile rate\" to stderr every upload period, which can be ignored; "+
+			"the perf_event CPU profilers sample at the rate without the warning",
+			"sample_rate", sampleRate)
+	}
+
+	return internal.RateCollector(int(sampleRate))
+}
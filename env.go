@@ -0,0 +1,188 @@
+package pyroscope
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/pyroscope-go/internal/labelset"
+	"github.com/grafana/pyroscope-go/resource"
+)
+
+// Environment variables read by ConfigFromEnv.
+const (
+	EnvServerAddress        = "PYROSCOPE_SERVER_ADDRESS"
+	EnvApplicationName      = "PYROSCOPE_APPLICATION_NAME"
+	EnvBasicAuthUser        = "PYROSCOPE_BASIC_AUTH_USER"
+	EnvBasicAuthPassword    = "PYROSCOPE_BASIC_AUTH_PASSWORD" //nolint:gosec
+	EnvTenantID             = "PYROSCOPE_TENANT_ID"
+	EnvTags                 = "PYROSCOPE_TAGS"          // k=v,k2=v2
+	EnvProfileTypes         = "PYROSCOPE_PROFILE_TYPES" // cpu,inuse_space
+	EnvUploadRate           = "PYROSCOPE_UPLOAD_RATE"   // 15s
+	EnvHTTPHeaders          = "PYROSCOPE_HTTP_HEADERS"  // k=v,k2=v2
+	EnvDisableGCRuns        = "PYROSCOPE_DISABLE_GC_RUNS"
+	EnvUsePushAPI           = "PYROSCOPE_USE_PUSH_API"
+	EnvMutexProfileFraction = "PYROSCOPE_MUTEX_PROFILE_FRACTION"
+	EnvBlockProfileRate     = "PYROSCOPE_BLOCK_PROFILE_RATE"
+	EnvMemProfileRate       = "PYROSCOPE_MEM_PROFILE_RATE"
+	EnvDetectResources      = "PYROSCOPE_DETECT_RESOURCES" // enables resource.Default() detectors
+	EnvSampleRate           = "PYROSCOPE_SAMPLE_RATE"      // CPU samples per second
+)
+
+// ConfigFromEnv returns the Config specified with the PYROSCOPE_*
+// environment variables, so that profiling can be configured without
+// changes in the code:
+//
+//	cfg, err := pyroscope.ConfigFromEnv()
+//	if err != nil {
+//		return err
+//	}
+//	cfg.Logger = pyroscope.StandardLogger
+//	profiler, err := pyroscope.Start(cfg)
+//
+// Variables that are not set leave the corresponding fields zero. All the
+// invalid values are reported in the returned error.
+func ConfigFromEnv() (Config, error) {
+	var (
+		cfg  Config
+		errs []error
+	)
+	cfg.ServerAddress = os.Getenv(EnvServerAddress)
+	cfg.ApplicationName = os.Getenv(EnvApplicationName)
+	cfg.BasicAuthUser = os.Getenv(EnvBasicAuthUser)
+	cfg.BasicAuthPassword = os.Getenv(EnvBasicAuthPassword)
+	cfg.TenantID = os.Getenv(EnvTenantID)
+
+	parse := func(name string, fn func(string) error) {
+		if v, ok := os.LookupEnv(name); ok && v != "" {
+			if err := fn(v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	}
+	parse(EnvTags, func(v string) (err error) {
+		if cfg.Tags, err = parseKeyValues(v); err != nil {
+			return err
+		}
+		for _, k := range slices.Sorted(maps.Keys(cfg.Tags)) {
+			if err = labelset.ValidateLabelName(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	parse(EnvHTTPHeaders, func(v string) (err error) {
+		cfg.HTTPHeaders, err = parseKeyValues(v)
+
+		return err
+	})
+	parse(EnvProfileTypes, func(v string) (err error) {
+		cfg.ProfileTypes, err = parseProfileTypes(v)
+
+		return err
+	})
+	parse(EnvUploadRate, func(v string) (err error) {
+		cfg.UploadRate, err = time.ParseDuration(v)
+		if err == nil && cfg.UploadRate <= 0 {
+			err = fmt.Errorf("upload rate must be positive, got %s", v) //nolint:err113
+		}
+
+		return err
+	})
+	parse(EnvDisableGCRuns, func(v string) (err error) {
+		cfg.DisableGCRuns, err = strconv.ParseBool(v)
+
+		return err
+	})
+	parse(EnvUsePushAPI, func(v string) (err error) {
+		cfg.UsePushAPI, err = strconv.ParseBool(v)
+
+		return err
+	})
+	parse(EnvDetectResources, func(v string) error {
+		detect, err := strconv.ParseBool(v)
+		if detect {
+			cfg.ResourceDetectors = resource.Default()
+		}
+
+		return err
+	})
+	parse(EnvMutexProfileFraction, func(v string) (err error) {
+		cfg.MutexProfileFraction, err = parseRate(v)
+
+		return err
+	})
+	parse(EnvBlockProfileRate, func(v string) (err error) {
+		cfg.BlockProfileRate, err = parseRate(v)
+
+		return err
+	})
+	parse(EnvMemProfileRate, func(v string) (err error) {
+		cfg.MemProfileRate, err = parseRate(v)
+
+		return err
+	})
+	parse(EnvSampleRate, func(v string) error {
+		rate, err := parseRate(v)
+		if err == nil && rate > math.MaxUint32 {
+			return fmt.Errorf("rate is too large, got %s", v) //nolint:err113
+		}
+		cfg.SampleRate = uint32(rate) //nolint:gosec
+
+		return err
+	})
+
+	return cfg, errors.Join(errs...)
+}
+
+// parseKeyValues parses comma separated key=value pairs.
+func parseKeyValues(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid key=value pair %q", kv) //nolint:err113
+		}
+		m[k] = strings.TrimSpace(v)
+	}
+
+	return m, nil
+}
+
+// parseRate parses a profiling rate, which must not be negative.
+func parseRate(s string) (int, error) {
+	rate, err := strconv.Atoi(s)
+	if err == nil && rate < 0 {
+		err = fmt.Errorf("rate must not be negative, got %s", s) //nolint:err113
+	}
+
+	return rate, err
+}
+
+func parseProfileTypes(s string) ([]ProfileType, error) {
+	var types []ProfileType
+	for _, t := range strings.Split(s, ",") {
+		pt := ProfileType(strings.TrimSpace(t))
+		if pt == "" {
+			continue
+		}
+		if !slices.Contains(profileTypes, pt) {
+			return nil, fmt.Errorf("unknown profile type %q", pt) //nolint:err113
+		}
+		types = append(types, pt)
+	}
+
+	return types, nil
+}
@@ -0,0 +1,69 @@
+package pyroscope
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv(EnvServerAddress, "http://pyroscope:4040")
+	t.Setenv(EnvApplicationName, "my-app")
+	t.Setenv(EnvBasicAuthUser, "user")
+	t.Setenv(EnvBasicAuthPassword, "password")
+	t.Setenv(EnvTenantID, "tenant")
+	t.Setenv(EnvTags, "env=prod, region = eu ,")
+	t.Setenv(EnvHTTPHeaders, "X-Extra=1")
+	t.Setenv(EnvProfileTypes, "cpu,mutex_count")
+	t.Setenv(EnvUploadRate, "30s")
+	t.Setenv(EnvDisableGCRuns, "true")
+	t.Setenv(EnvMutexProfileFraction, "5")
+	t.Setenv(EnvSampleRate, "49")
+
+	cfg, err := ConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, Config{
+		ServerAddress:        "http://pyroscope:4040",
+		ApplicationName:      "my-app",
+		BasicAuthUser:        "user",
+		BasicAuthPassword:    "password",
+		TenantID:             "tenant",
+		Tags:                 map[string]string{"env": "prod", "region": "eu"},
+		HTTPHeaders:          map[string]string{"X-Extra": "1"},
+		ProfileTypes:         []ProfileType{ProfileCPU, ProfileMutexCount},
+		UploadRate:           30 * time.Second,
+		DisableGCRuns:        true,
+		MutexProfileFraction: 5,
+		SampleRate:           49,
+	}, cfg)
+}
+
+func TestConfigFromEnvInvalid(t *testing.T) {
+	t.Setenv(EnvTags, "env")
+	t.Setenv(EnvProfileTypes, "cpu,heap")
+	t.Setenv(EnvUploadRate, "-1s")
+	t.Setenv(EnvBlockProfileRate, "often")
+
+	_, err := ConfigFromEnv()
+	require.Error(t, err)
+	assert.Equal(t, `PYROSCOPE_TAGS: invalid key=value pair "env"
+PYROSCOPE_PROFILE_TYPES: unknown profile type "heap"
+PYROSCOPE_UPLOAD_RATE: upload rate must be positive, got -1s
+PYROSCOPE_BLOCK_PROFILE_RATE: strconv.Atoi: parsing "often": invalid syntax`, err.Error())
+}
+
+func TestConfigFromEnvInvalidValues(t *testing.T) {
+	t.Setenv(EnvTags, "env=prod,region-name=eu")
+	t.Setenv(EnvMutexProfileFraction, "-1")
+	t.Setenv(EnvMemProfileRate, "-512")
+	t.Setenv(EnvSampleRate, "-100")
+
+	_, err := ConfigFromEnv()
+	require.Error(t, err)
+	assert.Equal(t, `PYROSCOPE_TAGS: invalid label name: region-name: character is not allowed: '-'
+PYROSCOPE_MUTEX_PROFILE_FRACTION: rate must not be negative, got -1
+PYROSCOPE_MEM_PROFILE_RATE: rate must not be negative, got -512
+PYROSCOPE_SAMPLE_RATE: rate must not be negative, got -100`, err.Error())
+}
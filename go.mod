@@ -8,12 +8,12 @@ replace github.com/grafana/pyroscope-go/godeltaprof => ./godeltaprof
 
 require (
 	github.com/grafana/pyroscope-go/godeltaprof v0.1.11
+	github.com/klauspost/compress v1.18.7
 	github.com/stretchr/testify v1.11.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/klauspost/compress v1.18.7 // indirect
 	github.com/kr/pretty v0.3.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/objx v0.5.3 // indirect
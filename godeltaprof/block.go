@@ -60,7 +60,9 @@ func NewMutexProfilerWithOptions(options ProfileOptions) *BlockProfiler {
 		options: pprof.ProfileBuilderOptions{
 			GenericsFrames: options.GenericsFrames,
 			LazyMapping:    options.LazyMappings,
+			Deterministic:  options.Deterministic,
 		},
+		gz: newGz(options),
 	}
 }
 
@@ -92,7 +94,9 @@ func NewBlockProfilerWithOptions(options ProfileOptions) *BlockProfiler {
 		options: pprof.ProfileBuilderOptions{
 			GenericsFrames: options.GenericsFrames,
 			LazyMapping:    options.LazyMappings,
+			Deterministic:  options.Deterministic,
 		},
+		gz: newGz(options),
 	}
 }
 
@@ -102,7 +106,11 @@ func (d *BlockProfiler) Profile(w io.Writer) error {
 
 	p := d.runtimeProfile()
 
-	sort.Slice(p, func(i, j int) bool { return p[i].Cycles > p[j].Cycles })
+	if d.options.Deterministic {
+		pprof.SortBlockProfile(p)
+	} else {
+		sort.Slice(p, func(i, j int) bool { return p[i].Cycles > p[j].Cycles })
+	}
 
 	zw := d.gz.get(w)
 	stc := pprof.MutexProfileConfig()
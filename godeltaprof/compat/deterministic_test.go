@@ -0,0 +1,68 @@
+package compat
+
+import (
+	"bytes"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/pyroscope-go/godeltaprof"
+)
+
+func TestDeterministicHeapProfile(t *testing.T) {
+	runtime.GC()
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	options := godeltaprof.ProfileOptions{GenericsFrames: true, LazyMappings: true, Deterministic: true}
+	profiles := make([][]byte, 2)
+	for i := range profiles {
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, godeltaprof.NewHeapProfilerWithOptions(options).Profile(buf))
+		profiles[i] = buf.Bytes()
+	}
+	assert.Equal(t, profiles[0], profiles[1])
+
+	p, err := profile.Parse(bytes.NewReader(profiles[0]))
+	require.NoError(t, err)
+	assert.NotEmpty(t, p.Sample)
+	assert.Zero(t, p.TimeNanos)
+}
+
+func TestDeterministicBlockProfile(t *testing.T) {
+	runtime.SetBlockProfileRate(1)
+	defer runtime.SetBlockProfileRate(0)
+	blockOnChannel()
+
+	options := godeltaprof.ProfileOptions{Deterministic: true}
+	profiles := make([][]byte, 2)
+	for i := range profiles {
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, godeltaprof.NewBlockProfilerWithOptions(options).Profile(buf))
+		profiles[i] = buf.Bytes()
+	}
+	assert.Equal(t, profiles[0], profiles[1])
+	_, err := profile.Parse(bytes.NewReader(profiles[0]))
+	require.NoError(t, err)
+}
+
+func blockOnChannel() {
+	c := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(c)
+	}()
+	<-c
+}
+
+func TestNonDeterministicProfile(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, godeltaprof.NewHeapProfiler().Profile(buf))
+	p, err := profile.Parse(buf)
+	require.NoError(t, err)
+	assert.NotZero(t, p.TimeNanos)
+}
@@ -0,0 +1,77 @@
+package compat
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/pyroscope-go/godeltaprof"
+)
+
+func parkedGoroutine(ready chan<- struct{}, done <-chan struct{}) {
+	ready <- struct{}{}
+	<-done
+}
+
+func TestGoroutineProfile(t *testing.T) {
+	const n = 5
+	ready := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	for range n {
+		go pprof.Do(context.Background(), pprof.Labels("worker", "parked"), func(context.Context) {
+			parkedGoroutine(ready, done)
+		})
+		<-ready
+	}
+
+	p := godeltaprof.NewGoroutineProfilerWithOptions(godeltaprof.ProfileOptions{GoroutineStateLabels: true})
+	for range 2 { // The second profile reuses the cached frames.
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, p.Profile(buf))
+		prof, err := profile.Parse(buf)
+		require.NoError(t, err)
+		require.Len(t, prof.SampleType, 1)
+		assert.Equal(t, "goroutine", prof.SampleType[0].Type)
+
+		var parked int64
+		for _, s := range prof.Sample {
+			if !stackContains(s, "compat.parkedGoroutine") {
+				continue
+			}
+			parked += s.Value[0]
+			assert.Equal(t, []string{"parked"}, s.Label["worker"])
+			assert.Equal(t, []string{"chan receive"}, s.Label["state"])
+		}
+		assert.Equal(t, int64(n), parked)
+	}
+}
+
+func TestGoroutineProfileWithoutStateLabels(t *testing.T) {
+	p := godeltaprof.NewGoroutineProfiler()
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, p.Profile(buf))
+	prof, err := profile.Parse(buf)
+	require.NoError(t, err)
+	require.NotEmpty(t, prof.Sample)
+	for _, s := range prof.Sample {
+		assert.Empty(t, s.Label["state"])
+	}
+}
+
+func stackContains(s *profile.Sample, function string) bool {
+	for _, loc := range s.Location {
+		for _, line := range loc.Line {
+			if line.Function.Name == "github.com/grafana/pyroscope-go/godeltaprof/"+function {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -41,3 +41,12 @@ func TestRuntimeCyclesPerSecond(t *testing.T) {
 		"runtime_cyclesPerSecond",
 		"func github.com/grafana/pyroscope-go/godeltaprof/internal/pprof.runtime_cyclesPerSecond() int64")
 }
+
+func TestRuntimeGoroutineProfileWithLabels(t *testing.T) {
+	checkSignature(t, "runtime",
+		"pprof_goroutineProfileWithLabels",
+		"func runtime.pprof_goroutineProfileWithLabels(p []internal/profilerecord.StackRecord, labels []unsafe.Pointer) (n int, ok bool)")
+	checkSignature(t, "github.com/grafana/pyroscope-go/godeltaprof/internal/pprof",
+		"pprof_goroutineProfileWithLabels",
+		"func github.com/grafana/pyroscope-go/godeltaprof/internal/pprof.pprof_goroutineProfileWithLabels(p []github.com/grafana/pyroscope-go/godeltaprof/internal/pprof.StackRecord, labels []unsafe.Pointer) (n int, ok bool)")
+}
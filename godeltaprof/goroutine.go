@@ -0,0 +1,70 @@
+package godeltaprof
+
+import (
+	"io"
+	"sync"
+
+	"github.com/grafana/pyroscope-go/godeltaprof/internal/pprof"
+)
+
+// GoroutineProfiler is a profiler for the stacks of all current goroutines in Go programs.
+// It provides similar functionality to pprof.Lookup("goroutine").WriteTo, but with some key differences.
+//
+// Goroutine profiles are not cumulative, so the GoroutineProfiler does not compute a delta.
+// Instead, it keeps the symbolization results and the mappings between profiles, which
+// makes repeated profiles of thousands of goroutines cheaper than with runtime/pprof.
+//
+// The samples keep the pprof labels of the goroutines. With ProfileOptions.GoroutineStateLabels, they are
+// also labeled with the state of the goroutines, for example state="chan receive", and with the
+// duration they have been waiting for, bucketed as wait="1m+", "10m+", "1h+" or "1d+".
+// The states are read from a runtime.Stack traceback of all goroutines, which stops the
+// world for a time proportional to the number of goroutines.
+//
+// The GoroutineProfiler is safe for concurrent use, as it serializes access to
+// its internal state using a sync.Mutex.
+type GoroutineProfiler struct {
+	impl    pprof.GoroutineProfiler
+	mutex   sync.Mutex
+	options pprof.ProfileBuilderOptions
+	gz      gz
+}
+
+// NewGoroutineProfiler creates a new GoroutineProfiler instance without the state labels.
+//
+// Usage:
+//
+//	gp := godeltaprof.NewGoroutineProfiler()
+//	...
+//	err := gp.Profile(someWriter)
+func NewGoroutineProfiler() *GoroutineProfiler {
+	return &GoroutineProfiler{
+		impl: pprof.GoroutineProfiler{},
+		options: pprof.ProfileBuilderOptions{
+			GenericsFrames: true,
+			LazyMapping:    true,
+			CacheFrames:    true,
+		},
+	}
+}
+
+func NewGoroutineProfilerWithOptions(options ProfileOptions) *GoroutineProfiler {
+	return &GoroutineProfiler{
+		impl: pprof.GoroutineProfiler{StateLabels: options.GoroutineStateLabels},
+		options: pprof.ProfileBuilderOptions{
+			GenericsFrames: options.GenericsFrames,
+			LazyMapping:    options.LazyMappings,
+			Deterministic:  options.Deterministic,
+			CacheFrames:    true,
+		},
+		gz: newGz(options),
+	}
+}
+
+func (d *GoroutineProfiler) Profile(w io.Writer) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	zw := d.gz.get(w)
+
+	return d.impl.WriteGoroutineProto(w, zw, &d.options)
+}
@@ -4,18 +4,68 @@ import (
 	"io"
 
 	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
 )
 
+// Compression selects how the profiles are compressed.
+type Compression int
+
+const (
+	// CompressionGzip compresses the profiles with gzip at ProfileOptions.GzipLevel.
+	CompressionGzip Compression = iota
+	// CompressionNone writes the profiles as uncompressed protobuf.
+	CompressionNone
+	// CompressionZstd compresses the profiles with zstd at the fastest level.
+	CompressionZstd
+)
+
+// gz compresses the profiles with the reused writer of the compression.
 type gz struct {
-	w *gzip.Writer
+	compression Compression
+	level       int // gzip level, gzip.BestSpeed if zero
+
+	w    *gzip.Writer
+	zstd *zstd.Encoder
+}
+
+func newGz(options ProfileOptions) gz {
+	return gz{compression: options.Compression, level: options.GzipLevel}
 }
 
-func (g *gz) get(w io.Writer) *gzip.Writer {
+func (g *gz) get(w io.Writer) io.WriteCloser {
+	switch g.compression {
+	case CompressionNone:
+		return nopCloser{w}
+	case CompressionZstd:
+		if g.zstd == nil {
+			g.zstd, _ = zstd.NewWriter(nil,
+				zstd.WithEncoderLevel(zstd.SpeedFastest),
+				zstd.WithEncoderConcurrency(1),
+				zstd.WithLowerEncoderMem(true))
+		}
+		g.zstd.Reset(w)
+
+		return g.zstd
+	case CompressionGzip:
+	}
 	if g.w == nil {
-		zw, _ := gzip.NewWriterLevel(w, gzip.BestSpeed)
+		level := g.level
+		if level == 0 {
+			level = gzip.BestSpeed
+		}
+		zw, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			zw, _ = gzip.NewWriterLevel(w, gzip.BestSpeed)
+		}
 		g.w = zw
 	}
 	g.w.Reset(w)
 
 	return g.w
 }
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
@@ -5,6 +5,8 @@ import (
 	"compress/gzip"
 	"io"
 	"testing"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 func TestGz(t *testing.T) {
@@ -53,3 +55,47 @@ func TestGz(t *testing.T) {
 		}
 	}
 }
+
+func TestCompression(t *testing.T) {
+	blob := []byte("Hello, World! This is a test blob with some data to compress.")
+	decompress := map[Compression]func(r io.Reader) ([]byte, error){
+		CompressionNone: io.ReadAll,
+		CompressionGzip: func(r io.Reader) ([]byte, error) {
+			gzr, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+
+			return io.ReadAll(gzr)
+		},
+		CompressionZstd: func(r io.Reader) ([]byte, error) {
+			zr, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			defer zr.Close()
+
+			return io.ReadAll(zr)
+		},
+	}
+	for compression, fn := range decompress {
+		g := newGz(ProfileOptions{Compression: compression, GzipLevel: gzip.BestCompression})
+		for i := range 2 { // The writers are reused.
+			var buf bytes.Buffer
+			w := g.get(&buf)
+			if _, err := w.Write(blob); err != nil {
+				t.Fatalf("Failed to write blob %d: %v", i, err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Failed to close writer %d: %v", i, err)
+			}
+			decompressed, err := fn(&buf)
+			if err != nil {
+				t.Fatalf("Failed to decompress blob %d with compression %d: %v", i, compression, err)
+			}
+			if !bytes.Equal(blob, decompressed) {
+				t.Errorf("Blob %d mismatch with compression %d: %q", i, compression, decompressed)
+			}
+		}
+	}
+}
@@ -49,7 +49,9 @@ func NewHeapProfilerWithOptions(options ProfileOptions) *HeapProfiler {
 		options: pprof.ProfileBuilderOptions{
 			GenericsFrames: options.GenericsFrames,
 			LazyMapping:    options.LazyMappings,
+			Deterministic:  options.Deterministic,
 		},
+		gz: newGz(options),
 	}
 }
 
@@ -59,6 +61,9 @@ func (d *HeapProfiler) Profile(w io.Writer) error {
 
 	p := pprof.MemProfile(true)
 	rate := int64(runtime.MemProfileRate)
+	if d.options.Deterministic {
+		pprof.SortMemProfile(p)
+	}
 
 	zw := d.gz.get(w)
 	b := pprof.NewProfileBuilder(w, zw, &d.options, pprof.HeapProfileConfig(rate))
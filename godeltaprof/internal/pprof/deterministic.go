@@ -0,0 +1,26 @@
+package pprof
+
+import (
+	"cmp"
+	"slices"
+)
+
+// SortMemProfile sorts the records by their stacks and block sizes. The
+// location, function and string IDs are assigned in the order of the samples,
+// so the profiles of sorted records are reproducible with the Deterministic option.
+func SortMemProfile(p []MemProfileRecord) {
+	slices.SortStableFunc(p, func(a, b MemProfileRecord) int {
+		if c := slices.Compare(memRecordStack(&a), memRecordStack(&b)); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(memRecordBlockSize(&a), memRecordBlockSize(&b))
+	})
+}
+
+// SortBlockProfile sorts the records by their stacks, see SortMemProfile.
+func SortBlockProfile(p []BlockProfileRecord) {
+	slices.SortStableFunc(p, func(a, b BlockProfileRecord) int {
+		return slices.Compare(blockRecordStack(&a), blockRecordStack(&b))
+	})
+}
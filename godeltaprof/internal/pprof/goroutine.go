@@ -0,0 +1,268 @@
+package pprof
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Labels of the goroutine state, see GoroutineProfiler.StateLabels.
+const (
+	GoroutineStateLabel = "state"
+	GoroutineWaitLabel  = "wait"
+)
+
+func GoroutineProfileConfig() ProfileConfig {
+	return ProfileConfig{
+		PeriodType: ValueType{Typ: "goroutine", Unit: "count"},
+		Period:     1,
+		SampleType: []ValueType{{Typ: "goroutine", Unit: "count"}},
+	}
+}
+
+type GoroutineProfiler struct {
+	// StateLabels enables the state and wait labels, which are
+	// obtained from a runtime.Stack traceback of all goroutines.
+	StateLabels bool
+
+	stackBuf []byte
+}
+
+// goroutineState is the state of a goroutine as reported by runtime.Stack.
+type goroutineState struct {
+	state       string // for example "chan receive"
+	waitMinutes int
+}
+
+type goroutineSample struct {
+	key    string
+	stack  []uintptr
+	labels []Label
+	count  int64
+}
+
+// WriteGoroutineProto writes the profile of the goroutines in protobuf format to w.
+func (g *GoroutineProfiler) WriteGoroutineProto(w io.Writer, zw io.WriteCloser, opt *ProfileBuilderOptions) error {
+	records, labels := GoroutineProfile()
+	var states map[string][]goroutineState
+	if g.StateLabels {
+		states = parseGoroutineStates(g.stacks())
+	}
+
+	samples := make(map[string]*goroutineSample, len(records))
+	order := make([]*goroutineSample, 0, len(records))
+	signatures := make(map[string]string)
+	var key []byte
+	for i := range records {
+		stk := records[i].Stack
+		key = key[:0]
+		for _, pc := range stk {
+			key = binary.LittleEndian.AppendUint64(key, uint64(pc))
+		}
+		ls := labels[i]
+		if states != nil {
+			sig, ok := signatures[string(key)]
+			if !ok {
+				sig = stackSignature(stk)
+				signatures[string(key)] = sig
+			}
+			if s := states[sig]; len(s) > 0 {
+				states[sig] = s[1:]
+				ls = withStateLabels(ls, s[0])
+			}
+		}
+		for _, l := range ls {
+			key = append(key, 0)
+			key = append(key, l.Key...)
+			key = append(key, 0)
+			key = append(key, l.Value...)
+		}
+		if s, ok := samples[string(key)]; ok {
+			s.count++
+
+			continue
+		}
+		s := &goroutineSample{key: string(key), stack: stk, labels: ls, count: 1}
+		samples[s.key] = s
+		order = append(order, s)
+	}
+
+	if opt.Deterministic {
+		slices.SortFunc(order, func(a, b *goroutineSample) int { return strings.Compare(a.key, b.key) })
+	}
+
+	b := newProfileBuilder(w, zw, opt, GoroutineProfileConfig())
+	values := []int64{0}
+	for _, s := range order {
+		locs := b.LocsForStack(s.stack)
+		values[0] = s.count
+		start := b.pb.startMessage()
+		b.pb.int64s(tagSample_Value, values)
+		b.pb.uint64s(tagSample_Location, locs)
+		for _, l := range s.labels {
+			b.pbLabel(tagSample_Label, l.Key, l.Value, 0)
+		}
+		b.pb.endMessage(tagProfile_Sample, start)
+		b.flush()
+	}
+	b.Build()
+
+	return nil
+}
+
+// stacks returns the traceback of all goroutines.
+func (g *GoroutineProfiler) stacks() []byte {
+	if g.stackBuf == nil {
+		g.stackBuf = make([]byte, 64<<10)
+	}
+	for {
+		n := runtime.Stack(g.stackBuf, true)
+		if n < len(g.stackBuf) {
+			return g.stackBuf[:n]
+		}
+		g.stackBuf = make([]byte, 2*len(g.stackBuf))
+	}
+}
+
+func withStateLabels(labels []Label, s goroutineState) []Label {
+	res := make([]Label, 0, len(labels)+2)
+	res = append(res, labels...)
+	add := func(key, value string) {
+		if value == "" {
+			return
+		}
+		for _, l := range labels {
+			if l.Key == key { // User labels take precedence.
+				return
+			}
+		}
+		res = append(res, Label{Key: key, Value: value})
+	}
+	add(GoroutineStateLabel, s.state)
+	add(GoroutineWaitLabel, waitBucket(s.waitMinutes))
+
+	return res
+}
+
+// waitBucket returns the wait label value for the wait duration.
+func waitBucket(minutes int) string {
+	switch {
+	case minutes >= 24*60:
+		return "1d+"
+	case minutes >= 60:
+		return "1h+"
+	case minutes >= 10:
+		return "10m+"
+	case minutes >= 1:
+		return "1m+"
+	default:
+		return ""
+	}
+}
+
+// stackSignature returns the function names and lines of the stack,
+// omitting the runtime functions hidden in runtime.Stack tracebacks.
+func stackSignature(stk []uintptr) string {
+	var sb strings.Builder
+	frames := runtime.CallersFrames(stk)
+	for {
+		f, more := frames.Next()
+		if f.Function != "" && !strings.HasPrefix(f.Function, "runtime.") {
+			sb.WriteString(f.Function)
+			sb.WriteByte(':')
+			sb.WriteString(strconv.Itoa(f.Line))
+			sb.WriteByte('\n')
+		}
+		if !more {
+			return sb.String()
+		}
+	}
+}
+
+// parseGoroutineStates parses the runtime.Stack traceback of all goroutines
+// and returns their states by the signatures of their stacks:
+//
+//	goroutine 18 [chan receive, 2 minutes]:
+//	main.worker(0xc000012345)
+//		/src/main.go:12 +0x1c
+//	created by main.main in goroutine 1
+//		/src/main.go:20 +0x3c
+func parseGoroutineStates(text []byte) map[string][]goroutineState {
+	states := make(map[string][]goroutineState)
+	var (
+		sb       strings.Builder
+		state    goroutineState
+		function string
+		inside   bool
+	)
+	for len(text) > 0 {
+		var line []byte
+		line, text, _ = bytes.Cut(text, []byte("\n"))
+		switch {
+		case bytes.HasPrefix(line, []byte("goroutine ")):
+			state, inside = parseGoroutineHeader(line), true
+			sb.Reset()
+			function = ""
+		case !inside:
+		case len(line) == 0:
+			sig := sb.String()
+			states[sig] = append(states[sig], state)
+			inside = false
+		case line[0] == '\t':
+			if function == "" {
+				continue
+			}
+			// /src/main.go:12 +0x1c
+			fileLine, _, _ := bytes.Cut(line[1:], []byte(" "))
+			if i := bytes.LastIndexByte(fileLine, ':'); i >= 0 {
+				sb.WriteString(function)
+				sb.WriteByte(':')
+				sb.Write(fileLine[i+1:])
+				sb.WriteByte('\n')
+			}
+			function = ""
+		case bytes.HasPrefix(line, []byte("created by ")), bytes.HasPrefix(line, []byte("...")):
+			function = ""
+		default:
+			// main.worker(0xc000012345)
+			function = ""
+			if i := bytes.LastIndexByte(line, '('); i > 0 && !bytes.HasPrefix(line, []byte("runtime.")) {
+				function = string(line[:i])
+			}
+		}
+	}
+	if inside {
+		sig := sb.String()
+		states[sig] = append(states[sig], state)
+	}
+
+	return states
+}
+
+// parseGoroutineHeader parses the state of "goroutine 18 [chan receive, 2 minutes]:".
+func parseGoroutineHeader(line []byte) goroutineState {
+	var s goroutineState
+	start := bytes.IndexByte(line, '[')
+	end := bytes.LastIndexByte(line, ']')
+	if start < 0 || end < start {
+		return s
+	}
+	for i, part := range strings.Split(string(line[start+1:end]), ", ") {
+		if i == 0 {
+			s.state = part
+
+			continue
+		}
+		if n, ok := strings.CutSuffix(part, " minutes"); ok {
+			s.waitMinutes, _ = strconv.Atoi(n)
+		} else if n, ok = strings.CutSuffix(part, " minute"); ok {
+			s.waitMinutes, _ = strconv.Atoi(n)
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,45 @@
+package pprof
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGoroutineStates(t *testing.T) {
+	text := `goroutine 1 [running]:
+main.main()
+	/src/main.go:30 +0x1c
+
+goroutine 18 [chan receive, 2 minutes]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/go/src/runtime/proc.go:435 +0xce
+main.worker(0xc000012345)
+	/src/main.go:12 +0x1c
+created by main.main in goroutine 1
+	/src/main.go:20 +0x3c
+
+goroutine 19 gp=0xc000102380 m=nil [select, 75 minutes, locked to thread]:
+main.worker(...)
+	/src/main.go:12
+main.(*server).serve(0xc000012345)
+	/src/server.go:7 +0x1c
+`
+	expected := map[string][]goroutineState{
+		"main.main:30\n":                           {{state: "running"}},
+		"main.worker:12\n":                         {{state: "chan receive", waitMinutes: 2}},
+		"main.worker:12\nmain.(*server).serve:7\n": {{state: "select", waitMinutes: 75}},
+	}
+	states := parseGoroutineStates([]byte(text))
+	if !reflect.DeepEqual(states, expected) {
+		t.Fatalf("expected %v, got %v", expected, states)
+	}
+}
+
+func TestWithStateLabels(t *testing.T) {
+	labels := []Label{{Key: "state", Value: "user"}, {Key: "worker", Value: "1"}}
+	res := withStateLabels(labels, goroutineState{state: "select", waitMinutes: 75})
+	expected := []Label{{Key: "state", Value: "user"}, {Key: "worker", Value: "1"}, {Key: "wait", Value: "1h+"}}
+	if !reflect.DeepEqual(res, expected) {
+		t.Fatalf("expected %v, got %v", expected, res)
+	}
+}
@@ -12,8 +12,6 @@ import (
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/klauspost/compress/gzip"
 )
 
 type ProfileBuilderOptions struct {
@@ -21,7 +19,20 @@ type ProfileBuilderOptions struct {
 	// if false - use runtime.Frame->Function - produces frames with generic types omitted [...]
 	GenericsFrames bool
 	LazyMapping    bool
-	mem            []memMap
+	// if true - the symbolization results are cached across profiles built
+	// with the options, as the mappings are with LazyMapping.
+	CacheFrames bool
+	// if true - the profiles are reproducible: the time of the profile is omitted.
+	// The samples must be added in a canonical order, see SortMemProfile and
+	// SortBlockProfile.
+	Deterministic bool
+	mem           []memMap
+	frames        map[uintptr]cachedFrames
+}
+
+type cachedFrames struct {
+	frames          []runtime.Frame
+	symbolizeResult symbolizeFlag
 }
 
 func (d *ProfileBuilderOptions) mapping() []memMap {
@@ -32,6 +43,22 @@ func (d *ProfileBuilderOptions) mapping() []memMap {
 	return d.mem
 }
 
+func (d *ProfileBuilderOptions) allFrames(addr uintptr) ([]runtime.Frame, symbolizeFlag) {
+	if !d.CacheFrames {
+		return allFrames(addr)
+	}
+	if f, ok := d.frames[addr]; ok {
+		return f.frames, f.symbolizeResult
+	}
+	if d.frames == nil {
+		d.frames = make(map[uintptr]cachedFrames)
+	}
+	frames, symbolizeResult := allFrames(addr)
+	d.frames[addr] = cachedFrames{frames: frames, symbolizeResult: symbolizeResult}
+
+	return frames, symbolizeResult
+}
+
 // A profileBuilder writes a profile incrementally from a
 // stream of profile samples delivered by the runtime.
 type profileBuilder struct {
@@ -42,7 +69,7 @@ type profileBuilder struct {
 
 	// encoding state
 	w         io.Writer
-	zw        *gzip.Writer
+	zw        io.WriteCloser // compresses the profile, if the profile is compressed
 	pb        protobuf
 	strings   []string
 	stringMap map[string]int
@@ -270,7 +297,11 @@ type locInfo struct {
 // CPU profiling data obtained from the runtime can be added
 // by calling b.addCPUData, and then the eventual profile
 // can be obtained by calling b.finish.
-func NewProfileBuilder(w io.Writer, zw *gzip.Writer, opt *ProfileBuilderOptions, stc ProfileConfig) ProfileBuilder {
+func NewProfileBuilder(w io.Writer, zw io.WriteCloser, opt *ProfileBuilderOptions, stc ProfileConfig) ProfileBuilder {
+	return newProfileBuilder(w, zw, opt, stc)
+}
+
+func newProfileBuilder(w io.Writer, zw io.WriteCloser, opt *ProfileBuilderOptions, stc ProfileConfig) *profileBuilder {
 	b := &profileBuilder{
 		w:         w,
 		zw:        zw,
@@ -299,7 +330,9 @@ func NewProfileBuilder(w io.Writer, zw *gzip.Writer, opt *ProfileBuilderOptions,
 func (b *profileBuilder) Build() {
 	b.end = time.Now()
 
-	b.pb.int64Opt(tagProfile_TimeNanos, b.start.UnixNano())
+	if !b.opt.Deterministic {
+		b.pb.int64Opt(tagProfile_TimeNanos, b.start.UnixNano())
+	}
 	if b.havePeriod { // must be CPU profile
 		b.pbValueType(tagProfile_SampleType, "samples", "count")
 		b.pbValueType(tagProfile_SampleType, "cpu", "nanoseconds")
@@ -377,7 +410,7 @@ func (b *profileBuilder) LocsForStack(stk []uintptr) (newLocs []uint64) {
 			continue
 		}
 
-		frames, symbolizeResult := allFrames(addr)
+		frames, symbolizeResult := b.opt.allFrames(addr)
 		if len(frames) == 0 { // runtime.goexit.
 			if id := b.emitLocation(); id > 0 {
 				locs = append(locs, id)
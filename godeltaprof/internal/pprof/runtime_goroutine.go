@@ -0,0 +1,54 @@
+package pprof
+
+import "unsafe"
+
+// StackRecord mirrors internal/profilerecord.StackRecord.
+// The runtime writes into these via //go:linkname to
+// pprof_goroutineProfileWithLabels, so the field layout
+// MUST match the runtime's definition exactly.
+type StackRecord struct {
+	Stack []uintptr
+}
+
+// Label mirrors internal/runtime/pprof/label.Label.
+type Label struct {
+	Key   string
+	Value string
+}
+
+// labelMap mirrors the layout of runtime/pprof.labelMap,
+// which embeds internal/runtime/pprof/label.Set and which
+// the goroutine labels point to.
+type labelMap struct {
+	List []Label
+}
+
+//go:linkname pprof_goroutineProfileWithLabels runtime.pprof_goroutineProfileWithLabels
+func pprof_goroutineProfileWithLabels(p []StackRecord, labels []unsafe.Pointer) (n int, ok bool)
+
+// GoroutineProfile returns the stacks of all goroutines and their labels.
+func GoroutineProfile() ([]StackRecord, [][]Label) {
+	var (
+		p      []StackRecord
+		labels []unsafe.Pointer
+	)
+	n, _ := pprof_goroutineProfileWithLabels(nil, nil)
+	for {
+		// Allow for some goroutines to be created between the calls.
+		p = make([]StackRecord, n+10)
+		labels = make([]unsafe.Pointer, n+10)
+		var ok bool
+		n, ok = pprof_goroutineProfileWithLabels(p, labels)
+		if ok {
+			break
+		}
+	}
+	res := make([][]Label, n)
+	for i, l := range labels[:n] {
+		if l != nil {
+			res[i] = (*labelMap)(l).List
+		}
+	}
+
+	return p[:n], res
+}
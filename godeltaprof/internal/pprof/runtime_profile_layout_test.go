@@ -16,31 +16,80 @@ import (
 )
 
 // TestRuntimeProfileRecordLayout verifies that the locally declared
-// MemProfileRecord and BlockProfileRecord exactly match the layout of
-// internal/profilerecord.{Mem,Block}ProfileRecord in the active Go toolchain.
-// The runtime writes into our types via //go:linkname pprof_*ProfileInternal,
-// so any drift in field count, name, type, order, offset or struct size
-// silently corrupts the captured profile.
+// MemProfileRecord, BlockProfileRecord and StackRecord exactly match the layout of
+// internal/profilerecord.{Mem,Block}ProfileRecord and StackRecord in the active Go toolchain,
+// and that Label and labelMap match internal/runtime/pprof/label.{Label,Set}.
+// The runtime writes into our types via //go:linkname pprof_*ProfileInternal
+// and pprof_goroutineProfileWithLabels, so any drift in field count, name, type,
+// order, offset or struct size silently corrupts the captured profile.
 func TestRuntimeProfileRecordLayout(t *testing.T) {
-	src := findRuntimeProfileRecordSource(t)
-	pkg := loadProfileRecordPackage(t, src)
+	pkg := loadRuntimePackage(t, "profilerecord", findRuntimeSource(t,
+		filepath.Join("internal", "profilerecord", "profilerecord.go"),
+		filepath.Join("runtime", "internal", "profilerecord", "profilerecord.go"),
+	))
+	labelPkg := loadRuntimePackage(t, "label", findRuntimeSource(t,
+		filepath.Join("internal", "runtime", "pprof", "label", "labelset.go"),
+	))
 
 	cases := []struct {
-		name string
-		ours reflect.Type
+		name   string
+		pkg    *types.Package
+		theirs string
+		ours   reflect.Type
 	}{
-		{"MemProfileRecord", reflect.TypeOf(MemProfileRecord{})},
-		{"BlockProfileRecord", reflect.TypeOf(BlockProfileRecord{})},
+		{"MemProfileRecord", pkg, "MemProfileRecord", reflect.TypeOf(MemProfileRecord{})},
+		{"BlockProfileRecord", pkg, "BlockProfileRecord", reflect.TypeOf(BlockProfileRecord{})},
+		{"StackRecord", pkg, "StackRecord", reflect.TypeOf(StackRecord{})},
+		{"Label", labelPkg, "Label", reflect.TypeOf(Label{})},
+		// runtime/pprof.labelMap only embeds label.Set, see TestRuntimeLabelMapLayout.
+		{"labelMap", labelPkg, "Set", reflect.TypeOf(labelMap{})},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			theirs := lookupStruct(t, pkg, c.name)
+			theirs := lookupStruct(t, c.pkg, c.theirs)
 			compareLayout(t, c.name, theirs, c.ours)
 		})
 	}
 }
 
-func findRuntimeProfileRecordSource(t *testing.T) string {
+// TestRuntimeLabelMapLayout verifies that runtime/pprof.labelMap, which the
+// goroutine labels point to, still has the layout of label.Set, so that
+// TestRuntimeProfileRecordLayout covers our labelMap.
+func TestRuntimeLabelMapLayout(t *testing.T) {
+	src := findRuntimeSource(t, filepath.Join("runtime", "pprof", "label.go"))
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, src, nil, parser.SkipObjectResolution)
+	if err != nil {
+		t.Fatalf("parse %s: %v", src, err)
+	}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts, ok := spec.(*ast.TypeSpec)
+			if !ok || ts.Name.Name != "labelMap" {
+				continue
+			}
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				t.Fatalf("labelMap is %s, want struct{ label.Set }", types.ExprString(ts.Type))
+			}
+			fields := st.Fields.List
+			if len(fields) != 1 || len(fields[0].Names) != 0 || types.ExprString(fields[0].Type) != "label.Set" {
+				t.Fatalf("labelMap is %s, want struct{ label.Set }", types.ExprString(ts.Type))
+			}
+
+			return
+		}
+	}
+	t.Fatalf("type labelMap not found in %s", src)
+}
+
+// findRuntimeSource returns the first of the candidate files, relative to
+// GOROOT/src, that exists in the active Go toolchain.
+func findRuntimeSource(t *testing.T, candidates ...string) string {
 	t.Helper()
 	goroot := os.Getenv("GOROOT")
 	if goroot == "" {
@@ -53,23 +102,20 @@ func findRuntimeProfileRecordSource(t *testing.T) string {
 		goroot = string(bytes.TrimSpace(stdout.Bytes()))
 	}
 	if goroot == "" {
-		t.Fatal("GOROOT not set; cannot locate runtime profilerecord source")
-	}
-	candidates := []string{
-		filepath.Join(goroot, "src", "internal", "profilerecord", "profilerecord.go"),
-		filepath.Join(goroot, "src", "runtime", "internal", "profilerecord", "profilerecord.go"),
+		t.Fatal("GOROOT not set; cannot locate runtime source")
 	}
-	for _, p := range candidates {
+	for _, c := range candidates {
+		p := filepath.Join(goroot, "src", c)
 		if _, err := os.Stat(p); err == nil {
 			return p
 		}
 	}
-	t.Fatalf("runtime profilerecord source not found in any of: %v", candidates)
+	t.Fatalf("runtime source not found in any of: %v", candidates)
 
 	return ""
 }
 
-func loadProfileRecordPackage(t *testing.T, src string) *types.Package {
+func loadRuntimePackage(t *testing.T, name, src string) *types.Package {
 	t.Helper()
 	fset := token.NewFileSet()
 	file, err := parser.ParseFile(fset, src, nil, parser.SkipObjectResolution)
@@ -77,7 +123,7 @@ func loadProfileRecordPackage(t *testing.T, src string) *types.Package {
 		t.Fatalf("parse %s: %v", src, err)
 	}
 	conf := &types.Config{Importer: importer.Default()}
-	pkg, err := conf.Check("profilerecord", fset, []*ast.File{file}, nil)
+	pkg, err := conf.Check(name, fset, []*ast.File{file}, nil)
 	if err != nil {
 		t.Fatalf("type-check %s: %v", src, err)
 	}
@@ -132,7 +178,8 @@ func compareLayout(t *testing.T, name string, theirs *types.Struct, ours reflect
 				name, i, their.Name(), our.Name)
 		}
 
-		theirType := their.Type().String()
+		// The runtime types of the fields, such as label.Label, are mirrored in this package.
+		theirType := types.TypeString(their.Type(), func(*types.Package) string { return "pprof" })
 		ourType := our.Type.String()
 		if theirType != ourType {
 			t.Errorf("%s field %q: type mismatch: runtime=%s ours=%s",
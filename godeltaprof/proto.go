@@ -5,4 +5,18 @@ type ProfileOptions struct {
 	// if false - use runtime.Frame->Function - produces frames with generic types omitted [...]
 	GenericsFrames bool
 	LazyMappings   bool
+
+	// if true - the GoroutineProfiler labels the goroutines with their state and wait duration.
+	// Ignored by the other profilers.
+	GoroutineStateLabels bool
+
+	// if true - equal profiles are written as equal bytes: the samples are sorted by their stacks,
+	// the location and function IDs are assigned in this order and the time of the profile is omitted.
+	// Useful for content hashing and golden files.
+	Deterministic bool
+
+	// Compression selects how the profiles are compressed, gzip by default.
+	Compression Compression
+	// GzipLevel is the gzip compression level, gzip.BestSpeed if zero.
+	GzipLevel int
 }
@@ -0,0 +1,46 @@
+package pyroscope
+
+import (
+	"runtime/metrics"
+)
+
+// labelStaleHeap marks the heap profiles uploaded without a GC cycle in
+// the upload window, which show the heap as of the last cycle.
+const labelStaleHeap = "stale"
+
+// HeapGCPolicy limits the garbage collections the profiler forces to get
+// up-to-date heap profiles. The runtime updates the heap profile at the end
+// of each GC cycle, so in the upload windows without a cycle the profiler
+// forces one, unless DisableGCRuns is set or the policy does not allow it.
+// Otherwise, the heap profile of the last cycle is uploaded with the
+// stale="true" label.
+type HeapGCPolicy struct {
+	// ForceEvery is the number of consecutive upload windows without a
+	// GC cycle after which a GC is forced. Zero or one force a GC in every
+	// window without one.
+	ForceEvery int
+	// MaxHeapBytes, if not zero, prevents forcing a GC while the heap
+	// objects, including the unreachable ones, take more bytes, as
+	// collecting large heaps causes latency spikes.
+	MaxHeapBytes uint64
+}
+
+// allowsGC reports whether a GC can be forced after the number of upload
+// windows without a GC cycle.
+func (p HeapGCPolicy) allowsGC(windowsWithoutGC int) bool {
+	if windowsWithoutGC < p.ForceEvery {
+		return false
+	}
+
+	return p.MaxHeapBytes == 0 || heapObjectsBytes() <= p.MaxHeapBytes
+}
+
+func heapObjectsBytes() uint64 {
+	s := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(s)
+	if s[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+
+	return s[0].Value.Uint64()
+}
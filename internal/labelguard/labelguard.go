@@ -0,0 +1,539 @@
+// Package labelguard rewrites the sample labels of pprof profiles: it limits
+// their cardinality and splits profiles by label values.
+package labelguard
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// OtherValue replaces the label values over the limit.
+const OtherValue = "__other__"
+
+// pprof Profile, Sample and Label message field numbers.
+const (
+	profileSample      = 2
+	profileStringTable = 6
+	sampleValue        = 2
+	sampleLabel        = 3
+	labelKey           = 1
+	labelStr           = 2
+	labelNum           = 3
+	labelNumUnit       = 4
+)
+
+// pprof message field numbers of the locations, functions and other
+// references to the string table, used to drop unreferenced entries.
+const (
+	profileSampleType        = 1
+	profileMapping           = 3
+	profileLocation          = 4
+	profileFunction          = 5
+	profileDropFrames        = 7
+	profileKeepFrames        = 8
+	profilePeriodType        = 11
+	profileComment           = 13
+	profileDefaultSampleType = 14
+	sampleLocationID         = 1
+	mappingFilename          = 7
+	mappingBuildID           = 8
+	locationID               = 1
+	locationLine             = 4
+	lineFunctionID           = 1
+	functionID               = 1
+	functionName             = 2
+	functionSystemName       = 3
+	functionFilename         = 4
+)
+
+// Limits specifies the labels kept in profiles.
+type Limits struct {
+	// MaxValuesPerKey limits the number of distinct values of a label key
+	// in a profile; zero means no limit. The values with the largest total
+	// sample value are kept, others are replaced with OtherValue.
+	MaxValuesPerKey int
+	// PerKey overrides MaxValuesPerKey for specific keys.
+	PerKey map[string]int
+	// AllowedKeys, if not empty, lists the only label keys kept.
+	AllowedKeys []string
+	// DeniedKeys lists the label keys removed.
+	DeniedKeys []string
+}
+
+// Enabled reports whether any limit is set.
+func (l *Limits) Enabled() bool {
+	return l.MaxValuesPerKey > 0 || len(l.PerKey) > 0 || len(l.AllowedKeys) > 0 || len(l.DeniedKeys) > 0
+}
+
+func (l *Limits) limit(key string) int {
+	if n, ok := l.PerKey[key]; ok {
+		return n
+	}
+
+	return l.MaxValuesPerKey
+}
+
+func (l *Limits) allowed(key string) bool {
+	if slices.Contains(l.DeniedKeys, key) {
+		return false
+	}
+
+	return len(l.AllowedKeys) == 0 || slices.Contains(l.AllowedKeys, key)
+}
+
+// Overflow describes a label key that has more distinct values than allowed.
+type Overflow struct {
+	Key    string
+	Values int
+	Limit  int
+}
+
+type profile struct {
+	fields    []field
+	strings   []string
+	samples   map[int]*sample   // by field index
+	locations map[int]*location // by field index
+	functions map[int]*function // by field index
+	// stringRefs are the string table indices referenced by the
+	// fields other than samples and functions.
+	stringRefs []uint64
+}
+
+type sample struct {
+	fields    [][]byte // raw fields other than labels
+	labels    []label
+	locations []uint64
+	weight    int64
+	changed   bool
+}
+
+type location struct {
+	id        uint64
+	functions []uint64
+}
+
+type function struct {
+	id      uint64
+	strings []uint64
+}
+
+type label struct {
+	key, str, num, numUnit uint64
+}
+
+// Apply rewrites the labels of the profile, which may be gzipped,
+// according to the limits. The profile is returned unchanged if all its
+// labels are within the limits.
+func Apply(b []byte, limits Limits) ([]byte, []Overflow, error) {
+	raw, gzipped, err := decompress(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := parse(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse profile: %w", err)
+	}
+	overflows, changed := p.rewrite(&limits)
+	if !changed {
+		return b, overflows, nil
+	}
+	out := p.encode(nil)
+	if gzipped {
+		if out, err = compress(out); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return out, overflows, nil
+}
+
+// decompress returns the uncompressed profile and whether it was gzipped.
+func decompress(b []byte) ([]byte, bool, error) {
+	if !bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		return b, false, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, true, err
+	}
+	raw, err := io.ReadAll(r)
+
+	return raw, true, err
+}
+
+func compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	_, _ = w.Write(b)
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func parse(b []byte) (*profile, error) {
+	p := &profile{
+		samples:   make(map[int]*sample),
+		locations: make(map[int]*location),
+		functions: make(map[int]*function),
+	}
+	err := fields(b, func(f field) error {
+		var err error
+		switch {
+		case f.num == profileStringTable && f.typ == wireBytes:
+			p.strings = append(p.strings, string(f.payload))
+		case f.num == profileSample && f.typ == wireBytes:
+			var s *sample
+			if s, err = parseSample(f.payload); err == nil {
+				p.samples[len(p.fields)] = s
+			}
+		case f.num == profileLocation && f.typ == wireBytes:
+			var l *location
+			if l, err = parseLocation(f.payload); err == nil {
+				p.locations[len(p.fields)] = l
+			}
+		case f.num == profileFunction && f.typ == wireBytes:
+			fn := new(function)
+			err = fields(f.payload, func(f field) error {
+				switch f.num {
+				case functionID:
+					fn.id = f.value
+				case functionName, functionSystemName, functionFilename:
+					fn.strings = append(fn.strings, f.value)
+				}
+
+				return nil
+			})
+			p.functions[len(p.fields)] = fn
+		case f.num == profileMapping && f.typ == wireBytes:
+			err = p.parseStringRefs(f.payload, mappingFilename, mappingBuildID)
+		case (f.num == profileSampleType || f.num == profilePeriodType) && f.typ == wireBytes:
+			err = p.parseStringRefs(f.payload, 1, 2) // ValueType type and unit
+		case f.num == profileDropFrames || f.num == profileKeepFrames || f.num == profileDefaultSampleType:
+			p.stringRefs = append(p.stringRefs, f.value)
+		case f.num == profileComment:
+			p.stringRefs = appendVarints(p.stringRefs, f)
+		}
+		if err != nil {
+			return err
+		}
+		p.fields = append(p.fields, f)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range p.samples {
+		for _, l := range s.labels {
+			if l.key >= uint64(len(p.strings)) || l.str >= uint64(len(p.strings)) {
+				return nil, errMalformed
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// parseStringRefs adds the values of the fields of the message
+// that reference the string table to the string references.
+func (p *profile) parseStringRefs(b []byte, nums ...uint64) error {
+	return fields(b, func(f field) error {
+		if slices.Contains(nums, f.num) {
+			p.stringRefs = append(p.stringRefs, f.value)
+		}
+
+		return nil
+	})
+}
+
+func parseLocation(b []byte) (*location, error) {
+	l := new(location)
+	err := fields(b, func(f field) error {
+		switch {
+		case f.num == locationID:
+			l.id = f.value
+		case f.num == locationLine && f.typ == wireBytes:
+			return fields(f.payload, func(f field) error {
+				if f.num == lineFunctionID {
+					l.functions = append(l.functions, f.value)
+				}
+
+				return nil
+			})
+		}
+
+		return nil
+	})
+
+	return l, err
+}
+
+// appendVarints appends the values of a repeated varint field,
+// which may be packed.
+func appendVarints(values []uint64, f field) []uint64 {
+	if f.typ != wireBytes {
+		return append(values, f.value)
+	}
+	for b := f.payload; len(b) > 0; {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			break
+		}
+		values = append(values, v)
+		b = b[n:]
+	}
+
+	return values
+}
+
+func parseSample(b []byte) (*sample, error) {
+	s := new(sample)
+	weightSet := false
+	err := fields(b, func(f field) error {
+		switch {
+		case f.num == sampleLocationID:
+			s.locations = appendVarints(s.locations, f)
+		case f.num == sampleLabel && f.typ == wireBytes:
+			var l label
+			err := fields(f.payload, func(f field) error {
+				switch f.num {
+				case labelKey:
+					l.key = f.value
+				case labelStr:
+					l.str = f.value
+				case labelNum:
+					l.num = f.value
+				case labelNumUnit:
+					l.numUnit = f.value
+				}
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			s.labels = append(s.labels, l)
+
+			return nil
+		case f.num == sampleValue && !weightSet:
+			weightSet = true
+			if f.typ == wireBytes {
+				v, _ := binary.Uvarint(f.payload)
+				s.weight = int64(v) //nolint:gosec
+			} else {
+				s.weight = int64(f.value) //nolint:gosec
+			}
+		}
+		s.fields = append(s.fields, f.raw)
+
+		return nil
+	})
+
+	return s, err
+}
+
+func (p *profile) rewrite(limits *Limits) ([]Overflow, bool) {
+	weights := make(map[uint64]map[uint64]int64)
+	for _, s := range p.samples {
+		for _, l := range s.labels {
+			if l.str == 0 || !limits.allowed(p.strings[l.key]) {
+				continue
+			}
+			if weights[l.key] == nil {
+				weights[l.key] = make(map[uint64]int64)
+			}
+			weights[l.key][l.str] += s.weight
+		}
+	}
+
+	var overflows []Overflow
+	replaced := make(map[uint64]map[uint64]bool)
+	for key, values := range weights {
+		limit := limits.limit(p.strings[key])
+		if limit <= 0 || len(values) <= limit {
+			continue
+		}
+		overflows = append(overflows, Overflow{Key: p.strings[key], Values: len(values), Limit: limit})
+		sorted := make([]uint64, 0, len(values))
+		for v := range values {
+			sorted = append(sorted, v)
+		}
+		slices.SortFunc(sorted, func(a, b uint64) int {
+			if values[a] != values[b] {
+				if values[a] > values[b] {
+					return -1
+				}
+
+				return 1
+			}
+
+			return strings.Compare(p.strings[a], p.strings[b])
+		})
+		replaced[key] = make(map[uint64]bool)
+		for _, v := range sorted[limit:] {
+			replaced[key][v] = true
+		}
+	}
+	slices.SortFunc(overflows, func(a, b Overflow) int { return strings.Compare(a.Key, b.Key) })
+
+	var other uint64
+	changed := false
+	for _, s := range p.samples {
+		labels := s.labels[:0]
+		for _, l := range s.labels {
+			if !limits.allowed(p.strings[l.key]) {
+				s.changed = true
+
+				continue
+			}
+			if replaced[l.key][l.str] {
+				if other == 0 {
+					other = p.stringIndex(OtherValue)
+				}
+				l.str = other
+				s.changed = true
+			}
+			labels = append(labels, l)
+		}
+		s.labels = labels
+		changed = changed || s.changed
+	}
+
+	return overflows, changed
+}
+
+// stringIndex returns the index of s in the string table, adding it if needed.
+func (p *profile) stringIndex(s string) uint64 {
+	if i := slices.Index(p.strings, s); i >= 0 {
+		return uint64(i)
+	}
+	p.strings = append(p.strings, s)
+	p.fields = append(p.fields, field{
+		num: profileStringTable,
+		typ: wireBytes,
+		raw: appendBytesField(nil, profileStringTable, []byte(s)),
+	})
+
+	return uint64(len(p.strings) - 1)
+}
+
+// encode encodes the profile, skipping the samples keep returns false for.
+// All samples are kept if keep is nil. Otherwise, the locations and the
+// functions the kept samples do not reference are dropped, and the strings
+// nothing references are replaced with empty strings, so that the parts of
+// a split profile are not much larger in total than the profile.
+func (p *profile) encode(keep func(*sample) bool) []byte {
+	var (
+		out  []byte
+		used *usage
+		str  int
+	)
+	if keep != nil {
+		used = p.usage(keep)
+	}
+	for i, f := range p.fields {
+		if used != nil {
+			if l, ok := p.locations[i]; ok && !used.locations[l.id] {
+				continue
+			}
+			if fn, ok := p.functions[i]; ok && !used.functions[fn.id] {
+				continue
+			}
+			if f.num == profileStringTable && f.typ == wireBytes {
+				str++
+				if !used.strings[str-1] {
+					out = appendBytesField(out, profileStringTable, nil)
+
+					continue
+				}
+			}
+		}
+		s, ok := p.samples[i]
+		if ok && keep != nil && !keep(s) {
+			continue
+		}
+		if !ok || !s.changed {
+			out = append(out, f.raw...)
+
+			continue
+		}
+		var b []byte
+		for _, raw := range s.fields {
+			b = append(b, raw...)
+		}
+		for _, l := range s.labels {
+			var lb []byte
+			for _, v := range []struct{ num, value uint64 }{
+				{labelKey, l.key}, {labelStr, l.str}, {labelNum, l.num}, {labelNumUnit, l.numUnit},
+			} {
+				if v.value != 0 {
+					lb = appendVarintField(lb, v.num, v.value)
+				}
+			}
+			b = appendBytesField(b, sampleLabel, lb)
+		}
+		out = appendBytesField(out, profileSample, b)
+	}
+
+	return out
+}
+
+// usage holds the entries of the profile referenced by the kept samples.
+type usage struct {
+	locations map[uint64]bool
+	functions map[uint64]bool
+	strings   []bool // by string table index
+}
+
+func (p *profile) usage(keep func(*sample) bool) *usage {
+	u := &usage{
+		locations: make(map[uint64]bool),
+		functions: make(map[uint64]bool),
+		strings:   make([]bool, len(p.strings)),
+	}
+	mark := func(i uint64) {
+		if i < uint64(len(u.strings)) {
+			u.strings[i] = true
+		}
+	}
+	mark(0)
+	for _, i := range p.stringRefs {
+		mark(i)
+	}
+	for _, s := range p.samples {
+		if !keep(s) {
+			continue
+		}
+		for _, id := range s.locations {
+			u.locations[id] = true
+		}
+		for _, l := range s.labels {
+			mark(l.key)
+			mark(l.str)
+			mark(l.numUnit)
+		}
+	}
+	for _, l := range p.locations {
+		if u.locations[l.id] {
+			for _, id := range l.functions {
+				u.functions[id] = true
+			}
+		}
+	}
+	for _, fn := range p.functions {
+		if u.functions[fn.id] {
+			for _, i := range fn.strings {
+				mark(i)
+			}
+		}
+	}
+
+	return u
+}
@@ -0,0 +1,143 @@
+package labelguard
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSample struct {
+	value  int64
+	labels map[string]string
+}
+
+func encodeProfile(samples ...testSample) []byte {
+	strs := []string{""}
+	index := func(s string) uint64 {
+		for i, x := range strs {
+			if x == s {
+				return uint64(i)
+			}
+		}
+		strs = append(strs, s)
+
+		return uint64(len(strs) - 1)
+	}
+	var b []byte
+	for _, s := range samples {
+		sb := appendVarintField(nil, 1, 1)
+		sb = appendBytesField(sb, sampleValue, binary.AppendUvarint(nil, uint64(s.value)))
+		for k, v := range s.labels {
+			lb := appendVarintField(nil, labelKey, index(k))
+			lb = appendVarintField(lb, labelStr, index(v))
+			sb = appendBytesField(sb, sampleLabel, lb)
+		}
+		b = appendBytesField(b, profileSample, sb)
+	}
+	for _, s := range strs {
+		b = appendBytesField(b, profileStringTable, []byte(s))
+	}
+
+	return b
+}
+
+func decodeLabels(t *testing.T, b []byte) []map[string]string {
+	t.Helper()
+	p, err := parse(b)
+	require.NoError(t, err)
+	res := make([]map[string]string, 0, len(p.samples))
+	for i := range p.fields {
+		s, ok := p.samples[i]
+		if !ok {
+			continue
+		}
+		labels := make(map[string]string)
+		for _, l := range s.labels {
+			labels[p.strings[l.key]] = p.strings[l.str]
+		}
+		res = append(res, labels)
+	}
+
+	return res
+}
+
+func TestApplyMaxValues(t *testing.T) {
+	profile := encodeProfile(
+		testSample{1, map[string]string{"user": "a", "route": "/1"}},
+		testSample{5, map[string]string{"user": "b", "route": "/1"}},
+		testSample{3, map[string]string{"user": "c", "route": "/2"}},
+		testSample{2, map[string]string{"user": "d"}},
+	)
+	res, overflows, err := Apply(profile, Limits{MaxValuesPerKey: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []Overflow{{Key: "user", Values: 4, Limit: 2}}, overflows)
+	assert.Equal(t, []map[string]string{
+		{"user": OtherValue, "route": "/1"},
+		{"user": "b", "route": "/1"},
+		{"user": "c", "route": "/2"},
+		{"user": OtherValue},
+	}, decodeLabels(t, res))
+}
+
+func TestApplyPerKey(t *testing.T) {
+	profile := encodeProfile(
+		testSample{1, map[string]string{"user": "a", "route": "/1"}},
+		testSample{1, map[string]string{"user": "b", "route": "/2"}},
+	)
+	res, overflows, err := Apply(profile, Limits{MaxValuesPerKey: 1, PerKey: map[string]int{"user": 0}})
+	require.NoError(t, err)
+	assert.Equal(t, []Overflow{{Key: "route", Values: 2, Limit: 1}}, overflows)
+	assert.Equal(t, []map[string]string{
+		{"user": "a", "route": "/1"},
+		{"user": "b", "route": OtherValue},
+	}, decodeLabels(t, res))
+}
+
+func TestApplyKeys(t *testing.T) {
+	profile := encodeProfile(
+		testSample{1, map[string]string{"user": "a", "route": "/1", "span_id": "1"}},
+	)
+	res, _, err := Apply(profile, Limits{AllowedKeys: []string{"route", "span_id"}, DeniedKeys: []string{"span_id"}})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]string{{"route": "/1"}}, decodeLabels(t, res))
+}
+
+func TestApplyUnchanged(t *testing.T) {
+	profile := encodeProfile(
+		testSample{1, map[string]string{"user": "a"}},
+		testSample{1, map[string]string{"user": "b"}},
+	)
+	res, overflows, err := Apply(profile, Limits{MaxValuesPerKey: 2, DeniedKeys: []string{"route"}})
+	require.NoError(t, err)
+	assert.Empty(t, overflows)
+	assert.Equal(t, profile, res)
+}
+
+func TestApplyGzip(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(encodeProfile(
+		testSample{2, map[string]string{"user": "a"}},
+		testSample{1, map[string]string{"user": "b"}},
+	))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	res, _, err := Apply(buf.Bytes(), Limits{MaxValuesPerKey: 1})
+	require.NoError(t, err)
+	r, err := gzip.NewReader(bytes.NewReader(res))
+	require.NoError(t, err)
+	raw, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]string{{"user": "a"}, {"user": OtherValue}}, decodeLabels(t, raw))
+}
+
+func TestApplyMalformed(t *testing.T) {
+	_, _, err := Apply([]byte{0xff}, Limits{MaxValuesPerKey: 1})
+	require.Error(t, err)
+}
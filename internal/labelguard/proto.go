@@ -0,0 +1,80 @@
+package labelguard
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errMalformed = errors.New("malformed protobuf")
+
+// field is a protobuf field, raw holds the complete
+// field encoding, payload the value of bytes fields.
+type field struct {
+	num     uint64
+	typ     uint64
+	value   uint64 // varint fields
+	payload []byte // bytes fields
+	raw     []byte
+}
+
+// fields iterates over the fields of a protobuf message.
+func fields(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		start := b
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errMalformed
+		}
+		b = b[n:]
+		f := field{num: tag >> 3, typ: tag & 7}
+		switch f.typ {
+		case wireVarint:
+			if f.value, n = binary.Uvarint(b); n <= 0 {
+				return errMalformed
+			}
+		case wireFixed64:
+			n = 8
+		case wireFixed32:
+			n = 4
+		case wireBytes:
+			l, m := binary.Uvarint(b)
+			if m <= 0 || uint64(len(b)-m) < l {
+				return errMalformed
+			}
+			f.payload = b[m : m+int(l)] //nolint:gosec
+			n = m + int(l)              //nolint:gosec
+		default:
+			return errMalformed
+		}
+		if n > len(b) {
+			return errMalformed
+		}
+		b = b[n:]
+		f.raw = start[:len(start)-len(b)]
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func appendVarintField(b []byte, num, v uint64) []byte {
+	b = binary.AppendUvarint(b, num<<3|wireVarint)
+
+	return binary.AppendUvarint(b, v)
+}
+
+func appendBytesField(b []byte, num uint64, v []byte) []byte {
+	b = binary.AppendUvarint(b, num<<3|wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+
+	return append(b, v...)
+}
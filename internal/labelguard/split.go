@@ -0,0 +1,81 @@
+package labelguard
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Part holds the samples of a profile that have the same values of the
+// split label keys. Labels maps the keys to the values; keys the samples
+// do not have are omitted.
+type Part struct {
+	Labels  map[string]string
+	Profile []byte
+}
+
+// Split splits the profile, which may be gzipped, by the values of the
+// label keys. The labels are removed from the samples of the parts, which
+// are ordered by their label values. If no sample has any of the labels,
+// the profile is returned unchanged as the only part.
+func Split(b []byte, keys []string) ([]Part, error) {
+	raw, gzipped, err := decompress(b)
+	if err != nil {
+		return nil, err
+	}
+	p, err := parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse profile: %w", err)
+	}
+
+	groups := make(map[*sample]string, len(p.samples))
+	parts := make(map[string]map[string]string)
+	found := false
+	for _, s := range p.samples {
+		values := make([]string, len(keys))
+		labels := s.labels[:0]
+		for _, l := range s.labels {
+			i := slices.Index(keys, p.strings[l.key])
+			if i < 0 || l.str == 0 {
+				labels = append(labels, l)
+
+				continue
+			}
+			values[i] = p.strings[l.str]
+			s.changed = true
+			found = true
+		}
+		s.labels = labels
+		group := strings.Join(values, "\x00")
+		groups[s] = group
+		if _, ok := parts[group]; !ok {
+			parts[group] = make(map[string]string)
+			for i, v := range values {
+				if v != "" {
+					parts[group][keys[i]] = v
+				}
+			}
+		}
+	}
+	if !found {
+		return []Part{{Labels: map[string]string{}, Profile: b}}, nil
+	}
+
+	order := make([]string, 0, len(parts))
+	for group := range parts {
+		order = append(order, group)
+	}
+	slices.Sort(order)
+	res := make([]Part, 0, len(order))
+	for _, group := range order {
+		out := p.encode(func(s *sample) bool { return groups[s] == group })
+		if gzipped {
+			if out, err = compress(out); err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, Part{Labels: parts[group], Profile: out})
+	}
+
+	return res, nil
+}
@@ -0,0 +1,100 @@
+package labelguard
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplit(t *testing.T) {
+	profile := encodeProfile(
+		testSample{1, map[string]string{"tenant": "b", "route": "/1"}},
+		testSample{2, map[string]string{"tenant": "a", "region": "eu"}},
+		testSample{3, map[string]string{"route": "/2"}},
+		testSample{4, map[string]string{"tenant": "a", "route": "/3"}},
+	)
+	parts, err := Split(profile, []string{"tenant", "region"})
+	require.NoError(t, err)
+	require.Len(t, parts, 4)
+
+	assert.Equal(t, map[string]string{}, parts[0].Labels)
+	assert.Equal(t, []map[string]string{{"route": "/2"}}, decodeLabels(t, parts[0].Profile))
+	assert.Equal(t, map[string]string{"tenant": "a"}, parts[1].Labels)
+	assert.Equal(t, []map[string]string{{"route": "/3"}}, decodeLabels(t, parts[1].Profile))
+	assert.Equal(t, map[string]string{"tenant": "a", "region": "eu"}, parts[2].Labels)
+	assert.Equal(t, []map[string]string{{}}, decodeLabels(t, parts[2].Profile))
+	assert.Equal(t, map[string]string{"tenant": "b"}, parts[3].Labels)
+	assert.Equal(t, []map[string]string{{"route": "/1"}}, decodeLabels(t, parts[3].Profile))
+}
+
+func TestSplitNoLabels(t *testing.T) {
+	profile := encodeProfile(testSample{1, map[string]string{"route": "/1"}})
+	parts, err := Split(profile, []string{"tenant"})
+	require.NoError(t, err)
+	assert.Equal(t, []Part{{Labels: map[string]string{}, Profile: profile}}, parts)
+}
+
+func TestSplitDropsUnreferenced(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	ready := make(chan struct{})
+	go pprof.Do(context.Background(), pprof.Labels("tenant", "tenant-a"), func(context.Context) {
+		splitWaitA(ready, stop)
+	})
+	go pprof.Do(context.Background(), pprof.Labels("tenant", "tenant-b"), func(context.Context) {
+		splitWaitB(ready, stop)
+	})
+	<-ready
+	<-ready
+
+	var buf bytes.Buffer
+	require.NoError(t, pprof.Lookup("goroutine").WriteTo(&buf, 0))
+	parts, err := Split(buf.Bytes(), []string{"tenant"})
+	require.NoError(t, err)
+	require.Len(t, parts, 3)
+
+	total := 0
+	for _, part := range parts {
+		raw, _, err := decompress(part.Profile)
+		require.NoError(t, err)
+		total += len(raw)
+		p, err := parse(raw)
+		require.NoError(t, err)
+		locations := make(map[uint64]bool)
+		for _, l := range p.locations {
+			locations[l.id] = true
+		}
+		for _, s := range p.samples {
+			for _, id := range s.locations {
+				require.True(t, locations[id], "sample references a dropped location")
+			}
+		}
+		for name, keep := range map[string]bool{
+			"splitWaitA": part.Labels["tenant"] == "tenant-a",
+			"splitWaitB": part.Labels["tenant"] == "tenant-b",
+			"tenant-a":   false,
+			"tenant-b":   false,
+		} {
+			assert.Equal(t, keep, bytes.Contains(raw, []byte(name)), "%s in part %v", name, part.Labels)
+		}
+	}
+	raw, _, err := decompress(buf.Bytes())
+	require.NoError(t, err)
+	assert.Less(t, total, 2*len(raw))
+}
+
+//go:noinline
+func splitWaitA(ready, stop chan struct{}) {
+	ready <- struct{}{}
+	<-stop
+}
+
+//go:noinline
+func splitWaitB(ready, stop chan struct{}) {
+	ready <- struct{}{}
+	<-stop
+}
@@ -0,0 +1,101 @@
+// Package logging implements leveled logging with key/value attributes
+// on top of the printf-style loggers accepted by the SDK.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Printf is the printf-style logger interface of the SDK.
+type Printf interface {
+	Infof(_ string, _ ...interface{})
+	Debugf(_ string, _ ...interface{})
+	Errorf(_ string, _ ...interface{})
+}
+
+// Slogger is implemented by loggers backed by a slog.Logger,
+// which receive structured records instead of formatted strings.
+type Slogger interface {
+	Slog() *slog.Logger
+}
+
+// Logger logs messages with key/value attributes, as slog.Logger does.
+// Records are passed to a slog.Logger if the underlying logger provides
+// one, otherwise attributes are appended to the message. Printf loggers
+// have no warning level, warnings are logged with Infof.
+type Logger struct {
+	printf Printf
+	slog   *slog.Logger
+}
+
+// New returns a Logger writing to p, which may be nil.
+func New(p Printf) *Logger {
+	l := &Logger{printf: p}
+	if s, ok := p.(Slogger); ok {
+		l.slog = s.Slog()
+	}
+
+	return l
+}
+
+func (l *Logger) Debug(msg string, args ...any) { l.log(slog.LevelDebug, msg, args) }
+func (l *Logger) Info(msg string, args ...any)  { l.log(slog.LevelInfo, msg, args) }
+func (l *Logger) Warn(msg string, args ...any)  { l.log(slog.LevelWarn, msg, args) }
+func (l *Logger) Error(msg string, args ...any) { l.log(slog.LevelError, msg, args) }
+
+func (l *Logger) log(level slog.Level, msg string, args []any) {
+	switch {
+	case l.slog != nil:
+		l.slog.Log(context.Background(), level, msg, args...)
+	case l.printf == nil:
+	case level >= slog.LevelError:
+		l.printf.Errorf("%s", format(msg, args))
+	case level >= slog.LevelInfo:
+		l.printf.Infof("%s", format(msg, args))
+	default:
+		l.printf.Debugf("%s", format(msg, args))
+	}
+}
+
+// format appends the attributes to the message as key=value pairs.
+func format(msg string, args []any) string {
+	if len(args) == 0 {
+		return msg
+	}
+	var b strings.Builder
+	b.WriteString(msg)
+	r := slog.NewRecord(time.Time{}, 0, "", 0)
+	r.Add(args...)
+	r.Attrs(func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+
+		return true
+	})
+
+	return b.String()
+}
+
+// SlogAdapter is a printf-style logger writing to a slog.Logger.
+type SlogAdapter struct {
+	l *slog.Logger
+}
+
+func NewSlogAdapter(l *slog.Logger) *SlogAdapter { return &SlogAdapter{l: l} }
+
+func (a *SlogAdapter) Infof(format string, args ...interface{}) {
+	a.l.Info(fmt.Sprintf(format, args...))
+}
+
+func (a *SlogAdapter) Debugf(format string, args ...interface{}) {
+	a.l.Debug(fmt.Sprintf(format, args...))
+}
+
+func (a *SlogAdapter) Errorf(format string, args ...interface{}) {
+	a.l.Error(fmt.Sprintf(format, args...))
+}
+
+func (a *SlogAdapter) Slog() *slog.Logger { return a.l }
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/pyroscope-go/internal/testutil"
+)
+
+var errConnectionReset = errors.New("connection reset")
+
+func TestPrintfLogger(t *testing.T) {
+	p := testutil.NewTestLogger()
+	l := New(p)
+	l.Debug("uploading profile")
+	l.Warn("upload queue is full", "profile_type", "process_cpu", "attempt", 2)
+	l.Error("failed to upload profile", "err", errConnectionReset)
+	New(nil).Info("discarded")
+
+	assert.Equal(t, []string{
+		"uploading profile",
+		"upload queue is full profile_type=process_cpu attempt=2",
+		"failed to upload profile err=connection reset",
+	}, p.Lines())
+}
+
+type levelLogger struct{ infos, errors []string }
+
+func (l *levelLogger) Debugf(string, ...interface{}) {}
+func (l *levelLogger) Infof(format string, args ...interface{}) {
+	l.infos = append(l.infos, fmt.Sprintf(format, args...))
+}
+
+func (l *levelLogger) Errorf(format string, args ...interface{}) {
+	l.errors = append(l.errors, fmt.Sprintf(format, args...))
+}
+
+func TestPrintfLoggerLevels(t *testing.T) {
+	p := new(levelLogger)
+	l := New(p)
+	l.Info("starting profiling session")
+	l.Warn("authtoken is deprecated")
+	l.Error("failed to upload profile")
+
+	assert.Equal(t, []string{"starting profiling session", "authtoken is deprecated"}, p.infos)
+	assert.Equal(t, []string{"failed to upload profile"}, p.errors)
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	a := NewSlogAdapter(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+
+			return a
+		},
+	})))
+	New(a).Warn("upload queue is full", "profile_type", "process_cpu")
+	a.Infof("starting %s", "session")
+
+	assert.Equal(t, "level=WARN msg=\"upload queue is full\" profile_type=process_cpu\n"+
+		"level=INFO msg=\"starting session\"\n", buf.String())
+}
@@ -0,0 +1,26 @@
+package pprof
+
+import "unsafe"
+
+// stackRecord mirrors internal/profilerecord.StackRecord. The runtime writes
+// into these via //go:linkname to pprof_goroutineProfileWithLabels, so the
+// layout MUST match the runtime's definition exactly, see
+// TestGoroutineProfileLayout.
+type stackRecord struct {
+	Stack []uintptr
+}
+
+// label mirrors internal/runtime/pprof/label.Label.
+type label struct {
+	Key   string
+	Value string
+}
+
+// labelMap mirrors the layout of runtime/pprof.labelMap,
+// which the goroutine labels point to.
+type labelMap struct {
+	List []label
+}
+
+//go:linkname pprof_goroutineProfileWithLabels runtime.pprof_goroutineProfileWithLabels
+func pprof_goroutineProfileWithLabels(p []stackRecord, labels []unsafe.Pointer) (n int, ok bool)
@@ -0,0 +1,208 @@
+package pprof
+
+import (
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+// TestGoroutineProfileLayout verifies that the locally declared stackRecord,
+// label and labelMap exactly match the layout of internal/profilerecord.StackRecord
+// and internal/runtime/pprof/label.{Label,Set} in the active Go toolchain.
+// The runtime writes into our types via //go:linkname pprof_goroutineProfileWithLabels,
+// so any drift in field count, name, type, order, offset or struct size silently
+// corrupts the captured profile.
+func TestGoroutineProfileLayout(t *testing.T) {
+	pkg := loadRuntimePackage(t, "profilerecord", findRuntimeSource(t,
+		filepath.Join("internal", "profilerecord", "profilerecord.go"),
+		filepath.Join("runtime", "internal", "profilerecord", "profilerecord.go"),
+	))
+	labelPkg := loadRuntimePackage(t, "label", findRuntimeSource(t,
+		filepath.Join("internal", "runtime", "pprof", "label", "labelset.go"),
+	))
+
+	cases := []struct {
+		name   string
+		pkg    *types.Package
+		theirs string
+		ours   reflect.Type
+	}{
+		{"stackRecord", pkg, "StackRecord", reflect.TypeOf(stackRecord{})},
+		{"label", labelPkg, "Label", reflect.TypeOf(label{})},
+		// runtime/pprof.labelMap only embeds label.Set, see TestRuntimeLabelMapLayout.
+		{"labelMap", labelPkg, "Set", reflect.TypeOf(labelMap{})},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			theirs := lookupStruct(t, c.pkg, c.theirs)
+			compareLayout(t, c.name, theirs, c.ours)
+		})
+	}
+}
+
+// TestRuntimeLabelMapLayout verifies that runtime/pprof.labelMap, which the
+// goroutine labels point to, still has the layout of label.Set, so that
+// TestGoroutineProfileLayout covers our labelMap.
+func TestRuntimeLabelMapLayout(t *testing.T) {
+	src := findRuntimeSource(t, filepath.Join("runtime", "pprof", "label.go"))
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, src, nil, parser.SkipObjectResolution)
+	if err != nil {
+		t.Fatalf("parse %s: %v", src, err)
+	}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts, ok := spec.(*ast.TypeSpec)
+			if !ok || ts.Name.Name != "labelMap" {
+				continue
+			}
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				t.Fatalf("labelMap is %s, want struct{ label.Set }", types.ExprString(ts.Type))
+			}
+			fields := st.Fields.List
+			if len(fields) != 1 || len(fields[0].Names) != 0 || types.ExprString(fields[0].Type) != "label.Set" {
+				t.Fatalf("labelMap is %s, want struct{ label.Set }", types.ExprString(ts.Type))
+			}
+
+			return
+		}
+	}
+	t.Fatalf("type labelMap not found in %s", src)
+}
+
+// findRuntimeSource returns the first of the candidate files, relative to
+// GOROOT/src, that exists in the active Go toolchain.
+func findRuntimeSource(t *testing.T, candidates ...string) string {
+	t.Helper()
+	goroot := os.Getenv("GOROOT")
+	if goroot == "" {
+		var stdout bytes.Buffer
+		cmd := exec.Command("go", "env", "GOROOT")
+		cmd.Stdout = &stdout
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("go env GOROOT: %v", err)
+		}
+		goroot = string(bytes.TrimSpace(stdout.Bytes()))
+	}
+	if goroot == "" {
+		t.Fatal("GOROOT not set; cannot locate runtime source")
+	}
+	for _, c := range candidates {
+		p := filepath.Join(goroot, "src", c)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	t.Fatalf("runtime source not found in any of: %v", candidates)
+
+	return ""
+}
+
+func loadRuntimePackage(t *testing.T, name, src string) *types.Package {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, src, nil, parser.SkipObjectResolution)
+	if err != nil {
+		t.Fatalf("parse %s: %v", src, err)
+	}
+	conf := &types.Config{Importer: importer.Default()}
+	pkg, err := conf.Check(name, fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatalf("type-check %s: %v", src, err)
+	}
+
+	return pkg
+}
+
+func lookupStruct(t *testing.T, pkg *types.Package, name string) *types.Struct {
+	t.Helper()
+	obj := pkg.Scope().Lookup(name)
+	if obj == nil {
+		t.Fatalf("type %s not found in %s", name, pkg.Path())
+	}
+	tn, ok := obj.(*types.TypeName)
+	if !ok {
+		t.Fatalf("%s is not a type name (got %T)", name, obj)
+	}
+	st, ok := tn.Type().Underlying().(*types.Struct)
+	if !ok {
+		t.Fatalf("%s underlying is %T, want *types.Struct", name, tn.Type().Underlying())
+	}
+
+	return st
+}
+
+func compareLayout(t *testing.T, name string, theirs *types.Struct, ours reflect.Type) {
+	t.Helper()
+	if ours.Kind() != reflect.Struct {
+		t.Fatalf("%s: ours is %s, want struct", name, ours.Kind())
+	}
+
+	if theirs.NumFields() != ours.NumField() {
+		t.Fatalf("%s: field count mismatch: runtime=%d ours=%d",
+			name, theirs.NumFields(), ours.NumField())
+	}
+
+	ptrSize := int64(unsafe.Sizeof(uintptr(0)))
+	sizes := &types.StdSizes{WordSize: ptrSize, MaxAlign: ptrSize}
+
+	theirFields := make([]*types.Var, theirs.NumFields())
+	for i := range theirs.NumFields() {
+		theirFields[i] = theirs.Field(i)
+	}
+	theirOffsets := sizes.Offsetsof(theirFields)
+
+	for i := range theirs.NumFields() {
+		their := theirs.Field(i)
+		our := ours.Field(i)
+
+		if their.Name() != our.Name {
+			t.Errorf("%s field %d: name mismatch: runtime=%q ours=%q",
+				name, i, their.Name(), our.Name)
+		}
+
+		// The runtime types of the fields, such as label.Label, are mirrored
+		// in this package by unexported types.
+		theirType := types.TypeString(their.Type(), func(*types.Package) string { return "pprof" })
+		ourType := our.Type.String()
+		if !strings.EqualFold(theirType, ourType) {
+			t.Errorf("%s field %q: type mismatch: runtime=%s ours=%s",
+				name, their.Name(), theirType, ourType)
+		}
+
+		theirSize := sizes.Sizeof(their.Type())
+		ourSize := int64(our.Type.Size())
+		if theirSize != ourSize {
+			t.Errorf("%s field %q: size mismatch: runtime=%d ours=%d",
+				name, their.Name(), theirSize, ourSize)
+		}
+
+		theirOffset := theirOffsets[i]
+		ourOffset := int64(our.Offset)
+		if theirOffset != ourOffset {
+			t.Errorf("%s field %q: offset mismatch: runtime=%d ours=%d",
+				name, their.Name(), theirOffset, ourOffset)
+		}
+	}
+
+	theirSize := sizes.Sizeof(theirs)
+	ourSize := int64(ours.Size())
+	if theirSize != ourSize {
+		t.Errorf("%s: struct size mismatch: runtime=%d ours=%d", name, theirSize, ourSize)
+	}
+}
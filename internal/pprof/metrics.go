@@ -0,0 +1,163 @@
+package pprof
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"runtime/metrics"
+	"sync"
+	"time"
+)
+
+// RuntimeMetrics lists the runtime/metrics recorded by the RuntimeMetricsProfiler.
+var RuntimeMetrics = []string{ //nolint:gochecknoglobals
+	"/sched/latencies:seconds",
+	"/gc/pauses:seconds",
+	"/sync/mutex/wait/total:seconds",
+}
+
+// metricBuckets are the upper bounds, in seconds, of the buckets
+// the histograms are regrouped into, so that the profiles do not
+// have a frame for each of the runtime's fine-grained buckets.
+var metricBuckets = []struct { //nolint:gochecknoglobals
+	upper float64
+	name  string
+}{
+	{1e-6, "<1µs"},
+	{1e-5, "1µs-10µs"},
+	{1e-4, "10µs-100µs"},
+	{1e-3, "100µs-1ms"},
+	{1e-2, "1ms-10ms"},
+	{1e-1, "10ms-100ms"},
+	{1, "100ms-1s"},
+	{10, "1s-10s"},
+	{math.Inf(1), ">=10s"},
+}
+
+// RuntimeMetricsProfiler turns the runtime/metrics histograms of the
+// scheduling latencies and GC pauses, and the total mutex wait time,
+// into a pprof profile of their increase since the previous profile.
+// Each histogram is a frame with a child frame per latency bucket, and
+// the samples have the number of events and their approximate total
+// duration.
+type RuntimeMetricsProfiler struct {
+	mu      sync.Mutex
+	samples []metrics.Sample
+	counts  [][]uint64 // the previous histogram counts
+	totals  []float64  // the previous float64 values
+	start   time.Time
+}
+
+func NewRuntimeMetricsProfiler() *RuntimeMetricsProfiler {
+	p := &RuntimeMetricsProfiler{
+		samples: make([]metrics.Sample, len(RuntimeMetrics)),
+		counts:  make([][]uint64, len(RuntimeMetrics)),
+		totals:  make([]float64, len(RuntimeMetrics)),
+	}
+	for i, name := range RuntimeMetrics {
+		p.samples[i].Name = name
+	}
+	p.read()
+
+	return p
+}
+
+// read reads the metrics and records their current values.
+func (p *RuntimeMetricsProfiler) read() {
+	metrics.Read(p.samples)
+	for i, s := range p.samples {
+		switch s.Value.Kind() {
+		case metrics.KindFloat64Histogram:
+			p.counts[i] = append(p.counts[i][:0], s.Value.Float64Histogram().Counts...)
+		case metrics.KindFloat64:
+			p.totals[i] = s.Value.Float64()
+		case metrics.KindUint64, metrics.KindBad:
+		}
+	}
+	p.start = time.Now()
+}
+
+// Profile writes the profile of the changes of the
+// metrics since the previous call, or since the creation.
+func (p *RuntimeMetricsProfiler) Profile(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prevCounts := make([][]uint64, len(p.counts))
+	for i := range p.counts {
+		prevCounts[i] = append([]uint64(nil), p.counts[i]...)
+	}
+	prevTotals := append([]float64(nil), p.totals...)
+	start := p.start
+	p.read()
+
+	e := newProfileEncoder()
+	for _, t := range [][2]string{{"events", "count"}, {"delay", "nanoseconds"}} {
+		e.body = appendBytesField(e.body, profileSampleType, e.valueType(t[0], t[1]))
+	}
+	for i, s := range p.samples {
+		switch s.Value.Kind() {
+		case metrics.KindFloat64Histogram:
+			h := s.Value.Float64Histogram()
+			if len(prevCounts[i]) != len(h.Counts) {
+				continue
+			}
+			encodeHistogram(e, s.Name, h, prevCounts[i])
+		case metrics.KindFloat64:
+			if d := s.Value.Float64() - prevTotals[i]; d > 0 {
+				e.sample([]uint64{e.frame(s.Name)}, 0, int64(d*1e9))
+			}
+		case metrics.KindUint64, metrics.KindBad:
+		}
+	}
+	e.body = appendVarintField(e.body, profileTimeNanos, uint64(start.UnixNano()))                    //nolint:gosec
+	e.body = appendVarintField(e.body, profileDurationNanos, uint64(time.Since(start).Nanoseconds())) //nolint:gosec
+	e.body = appendBytesField(e.body, profilePeriodType, e.valueType("delay", "nanoseconds"))
+	e.body = appendVarintField(e.body, profilePeriod, 1)
+
+	return e.writeTo(w)
+}
+
+// encodeHistogram adds the samples of the increase of the histogram counts
+// since prev, regrouped into metricBuckets. The duration of the events is
+// estimated with the middle of their bucket.
+func encodeHistogram(e *profileEncoder, name string, h *metrics.Float64Histogram, prev []uint64) {
+	counts := make([]int64, len(metricBuckets))
+	durations := make([]float64, len(metricBuckets))
+	for i, c := range h.Counts {
+		n := c - prev[i]
+		if n == 0 {
+			continue
+		}
+		lower, upper := h.Buckets[i], h.Buckets[i+1]
+		lower = max(lower, 0)
+		if math.IsInf(upper, 1) {
+			upper = lower
+		}
+		b := 0
+		for b < len(metricBuckets)-1 && lower >= metricBuckets[b].upper {
+			b++
+		}
+		counts[b] += int64(n) //nolint:gosec
+		durations[b] += float64(n) * (lower + upper) / 2
+	}
+	for b, n := range counts {
+		if n == 0 {
+			continue
+		}
+		// The innermost frame first.
+		e.sample([]uint64{e.frame(metricBuckets[b].name), e.frame(name)}, n, int64(durations[b]*1e9))
+	}
+}
+
+// sample adds a sample of the locations with the number of events and their duration.
+func (e *profileEncoder) sample(locations []uint64, count, nanoseconds int64) {
+	var ids []byte
+	for _, id := range locations {
+		ids = binary.AppendUvarint(ids, id)
+	}
+	b := appendBytesField(nil, 1, ids)
+	values := binary.AppendUvarint(nil, uint64(count))         //nolint:gosec
+	values = binary.AppendUvarint(values, uint64(nanoseconds)) //nolint:gosec
+	b = appendBytesField(b, 2, values)
+	e.body = appendBytesField(e.body, profileSample, b)
+}
@@ -0,0 +1,56 @@
+package pprof
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"testing"
+)
+
+func Test_RuntimeMetricsProfiler(t *testing.T) {
+	p := NewRuntimeMetricsProfiler()
+	runtime.GC()
+	runtime.GC()
+
+	var buf bytes.Buffer
+	if err := p.Profile(&buf); err != nil {
+		t.Fatalf("RuntimeMetricsProfiler Profile: %v", err)
+	}
+	r, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("invalid profile: %v", err)
+	}
+	profile, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("invalid profile: %v", err)
+	}
+	for _, s := range []string{"events", "delay", "/gc/pauses:seconds"} {
+		if !strings.Contains(string(profile), s) {
+			t.Errorf("profile does not contain %q", s)
+		}
+	}
+}
+
+func Test_encodeHistogram(t *testing.T) {
+	h := &metrics.Float64Histogram{
+		Buckets: []float64{math.Inf(-1), 0, 2e-6, 4e-6, 20, math.Inf(1)},
+		Counts:  []uint64{0, 3, 5, 2, 1},
+	}
+	prev := []uint64{0, 1, 5, 0, 1}
+	e := newProfileEncoder()
+	encodeHistogram(e, "/test:seconds", h, prev)
+
+	// 2 events in [0, 2µs) and 2 events in [4µs, 20s).
+	if len(e.frames) != 3 {
+		t.Fatalf("expected 3 frames, got %v", e.frames)
+	}
+	for _, name := range []string{"/test:seconds", "<1µs", "1µs-10µs"} {
+		if _, ok := e.frames[name]; !ok {
+			t.Errorf("expected frame %q, got %v", name, e.frames)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package pprof
+
+// PerfClock is the perf_event software event used to sample CPU stacks.
+type PerfClock uint64
+
+const (
+	// PerfCPUClock is PERF_COUNT_SW_CPU_CLOCK.
+	PerfCPUClock PerfClock = 0
+	// PerfTaskClock is PERF_COUNT_SW_TASK_CLOCK.
+	PerfTaskClock PerfClock = 1
+)
@@ -0,0 +1,334 @@
+package pprof
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// perfEventAttr is struct perf_event_attr, PERF_ATTR_SIZE_VER5.
+type perfEventAttr struct {
+	Type             uint32
+	Size             uint32
+	Config           uint64
+	SamplePeriod     uint64
+	SampleType       uint64
+	ReadFormat       uint64
+	Bits             uint64
+	WakeupEvents     uint32
+	BPType           uint32
+	Config1          uint64
+	Config2          uint64
+	BranchSampleType uint64
+	SampleRegsUser   uint64
+	SampleStackUser  uint32
+	ClockID          int32
+	SampleRegsIntr   uint64
+	AuxWatermark     uint32
+	SampleMaxStack   uint16
+	_                uint16
+}
+
+const (
+	perfTypeSoftware = 1
+
+	perfSampleIP        = 1 << 0
+	perfSampleTID       = 1 << 1
+	perfSampleCallchain = 1 << 5
+
+	perfBitExcludeKernel          = 1 << 5
+	perfBitExcludeHV              = 1 << 6
+	perfBitExcludeCallchainKernel = 1 << 21
+
+	perfRecordSample = 9
+
+	// perfContextMax is the smallest of the PERF_CONTEXT_* markers
+	// separating the kernel and user parts of the callchain.
+	perfContextMax = ^uint64(4095) + 1
+
+	// perfDataPages is the number of pages of the ring buffer of each
+	// thread, which must be a power of two.
+	perfDataPages = 16
+	// perfDataHeadOffset is the offset of data_head and data_tail
+	// in struct perf_event_mmap_page.
+	perfDataHeadOffset = 1024
+	perfDataTailOffset = 1032
+
+	perfPollInterval = 50 * time.Millisecond
+)
+
+var errPerfStarted = errors.New("cpu profiling already in use")
+
+// NewPerfCollector returns a Collector sampling the stacks of all the
+// threads of the process with the perf_event software clock event, hz
+// times per second. It returns an error if perf events are not permitted.
+//
+// Unlike runtime/pprof, the collector does not record pprof labels.
+func NewPerfCollector(clock PerfClock, hz int) (Collector, error) {
+	if hz <= 0 {
+		hz = defaultRate
+	}
+	c := &perfCollector{
+		clock:  clock,
+		period: time.Second / time.Duration(hz),
+	}
+	fd, err := c.open(0)
+	if err != nil {
+		return nil, fmt.Errorf("perf_event_open: %w", err)
+	}
+	_ = syscall.Close(fd)
+
+	return c, nil
+}
+
+type perfCollector struct {
+	clock  PerfClock
+	period time.Duration
+
+	mu      sync.Mutex
+	w       io.Writer
+	profile *stackProfile
+	inlined map[uintptr][]uintptr
+	threads map[int]*perfThread
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+type perfThread struct {
+	fd   int
+	mmap []byte
+}
+
+func (c *perfCollector) StartCPUProfile(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.w != nil {
+		return errPerfStarted
+	}
+	c.w = w
+	c.profile = newStackProfile("cpu", c.period)
+	c.inlined = make(map[uintptr][]uintptr)
+	c.threads = make(map[int]*perfThread)
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	c.scanThreads()
+	go c.poll(c.stop, c.done)
+
+	return nil
+}
+
+func (c *perfCollector) StopCPUProfile() {
+	c.mu.Lock()
+	if c.w == nil {
+		c.mu.Unlock()
+
+		return
+	}
+	close(c.stop)
+	done := c.done
+	c.mu.Unlock()
+	<-done
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range c.threads {
+		c.read(t)
+		t.close()
+	}
+	// As with pprof.StopCPUProfile, write errors are ignored.
+	_ = c.profile.write(c.w)
+	c.w, c.profile, c.threads = nil, nil, nil
+}
+
+func (c *perfCollector) poll(stop, done chan struct{}) {
+	defer close(done)
+	t := time.NewTicker(perfPollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			c.mu.Lock()
+			c.scanThreads()
+			for _, t := range c.threads {
+				c.read(t)
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// scanThreads starts sampling the threads created since the last scan,
+// and stops sampling the threads that have exited.
+func (c *perfCollector) scanThreads() {
+	entries, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return
+	}
+	alive := make(map[int]bool, len(entries))
+	for _, e := range entries {
+		tid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		alive[tid] = true
+		if _, ok := c.threads[tid]; ok {
+			continue
+		}
+		if t, err := c.openThread(tid); err == nil {
+			c.threads[tid] = t
+		}
+	}
+	for tid, t := range c.threads {
+		if !alive[tid] {
+			c.read(t)
+			t.close()
+			delete(c.threads, tid)
+		}
+	}
+}
+
+func (c *perfCollector) open(tid int) (int, error) {
+	attr := perfEventAttr{
+		Type:         perfTypeSoftware,
+		Config:       uint64(c.clock),
+		SamplePeriod: uint64(c.period.Nanoseconds()), //nolint:gosec
+		SampleType:   perfSampleIP | perfSampleTID | perfSampleCallchain,
+		Bits:         perfBitExcludeKernel | perfBitExcludeHV | perfBitExcludeCallchainKernel,
+	}
+	attr.Size = uint32(unsafe.Sizeof(attr))
+	fd, _, errno := syscall.Syscall6(syscall.SYS_PERF_EVENT_OPEN,
+		uintptr(unsafe.Pointer(&attr)), uintptr(tid), ^uintptr(0), ^uintptr(0), 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+
+	return int(fd), nil
+}
+
+func (c *perfCollector) openThread(tid int) (*perfThread, error) {
+	fd, err := c.open(tid)
+	if err != nil {
+		return nil, err
+	}
+	size := (perfDataPages + 1) * os.Getpagesize()
+	mmap, err := syscall.Mmap(fd, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		_ = syscall.Close(fd)
+
+		return nil, err
+	}
+
+	return &perfThread{fd: fd, mmap: mmap}, nil
+}
+
+func (t *perfThread) close() {
+	_ = syscall.Munmap(t.mmap)
+	_ = syscall.Close(t.fd)
+}
+
+// read adds the samples from the ring buffer of the thread to the profile.
+func (c *perfCollector) read(t *perfThread) {
+	head := atomic.LoadUint64((*uint64)(unsafe.Pointer(&t.mmap[perfDataHeadOffset])))
+	tailPtr := (*uint64)(unsafe.Pointer(&t.mmap[perfDataTailOffset]))
+	tail := atomic.LoadUint64(tailPtr)
+	data := t.mmap[os.Getpagesize():]
+	size := uint64(len(data))
+	var record []byte
+	var stack []uintptr
+	for tail < head {
+		// Records may wrap around the end of the buffer.
+		header := ringBytes(data, tail, 8, record[:0])
+		recordSize := uint64(binary.LittleEndian.Uint16(header[6:]))
+		if recordSize < 8 || recordSize > size {
+			break
+		}
+		record = ringBytes(data, tail, recordSize, header[:0])
+		tail += recordSize
+		if binary.LittleEndian.Uint32(record) != perfRecordSample {
+			continue
+		}
+		// u64 ip; u32 pid, tid; u64 nr; u64 ips[nr]
+		if len(record) < 32 {
+			continue
+		}
+		nr := binary.LittleEndian.Uint64(record[24:])
+		if uint64(len(record)-32)/8 < nr {
+			continue
+		}
+		stack = stack[:0]
+		for i := range nr {
+			pc := binary.LittleEndian.Uint64(record[32+8*i:])
+			if pc >= perfContextMax {
+				continue
+			}
+			if len(stack) == 0 {
+				// Symbolize the instruction pointer as a return address.
+				pc++
+			}
+			stack = c.appendInlined(stack, uintptr(pc))
+		}
+		if len(stack) > 0 {
+			c.profile.add(stack, nil, 1)
+		}
+	}
+	atomic.StoreUint64(tailPtr, tail)
+}
+
+// appendInlined appends the return address pc to the stack, followed by
+// the addresses of the callers inlined at pc, as runtime.Callers reports
+// them: the perf callchain only has the physical frames.
+func (c *perfCollector) appendInlined(stack []uintptr, pc uintptr) []uintptr {
+	pcs, ok := c.inlined[pc]
+	if !ok {
+		pcs = inlinedPCs(pc)
+		c.inlined[pc] = pcs
+	}
+
+	return append(stack, pcs...)
+}
+
+func inlinedPCs(pc uintptr) []uintptr {
+	if runtime.FuncForPC(pc-1) == nil {
+		// Not Go code.
+		return []uintptr{pc}
+	}
+	// CallersFrames only expands the inlined frames of an address followed
+	// by another one, which is zero here, and which has no frame.
+	frames := runtime.CallersFrames([]uintptr{pc, 0})
+	var pcs []uintptr
+	for {
+		f, more := frames.Next()
+		if f.PC != 0 {
+			// The frame PC is the one of the call instruction.
+			pcs = append(pcs, f.PC+1)
+		}
+		if !more {
+			break
+		}
+	}
+
+	return pcs
+}
+
+// ringBytes appends n bytes of the ring buffer data at offset to buf.
+func ringBytes(data []byte, offset, n uint64, buf []byte) []byte {
+	size := uint64(len(data))
+	start := offset % size
+	if end := start + n; end <= size {
+		return append(buf, data[start:end]...)
+	}
+	buf = append(buf, data[start:]...)
+
+	return append(buf, data[:n-(size-start)]...)
+}
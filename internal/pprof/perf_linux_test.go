@@ -0,0 +1,72 @@
+package pprof
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_PerfCollector(t *testing.T) {
+	c, err := NewPerfCollector(PerfTaskClock, 250)
+	if err != nil {
+		t.Skipf("perf events are not permitted: %v", err)
+	}
+	var buf bytes.Buffer
+	if err = c.StartCPUProfile(&buf); err != nil {
+		t.Fatalf("Perf collector StartCPUProfile: %v", err)
+	}
+	if err = c.StartCPUProfile(io.Discard); err == nil {
+		t.Fatalf("Perf collector must fail on consecutive StartCPUProfile")
+	}
+	perfBurnCPU(300 * time.Millisecond)
+	c.StopCPUProfile()
+
+	r, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("invalid profile: %v", err)
+	}
+	profile, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("invalid profile: %v", err)
+	}
+	if !strings.Contains(string(profile), "pprof.perfBurnCPU") {
+		t.Fatal("profile has no samples of perfBurnCPU")
+	}
+}
+
+//go:noinline
+func perfBurnCPU(d time.Duration) {
+	n := 0
+	for deadline := time.Now().Add(d); time.Now().Before(deadline); {
+		n++
+	}
+	_ = n
+}
+
+// inlinedCallers is inlined into its caller.
+func inlinedCallers(pcs []uintptr) int {
+	return runtime.Callers(1, pcs)
+}
+
+func Test_PerfInlinedPCs(t *testing.T) {
+	pcs := make([]uintptr, 2)
+	if inlinedCallers(pcs) != 2 {
+		t.Fatal("no callers")
+	}
+	if f, _ := runtime.CallersFrames(pcs).Next(); f.Func != nil {
+		t.Skip("inlinedCallers is not inlined")
+	}
+	// The first return address is the physical one.
+	got := inlinedPCs(pcs[0])
+	if !slices.Equal(got, pcs) {
+		t.Fatalf("inlinedPCs: got %x, want %x", got, pcs)
+	}
+	if got = inlinedPCs(pcs[1]); !slices.Equal(got, pcs[1:]) {
+		t.Fatalf("inlinedPCs: got %x, want %x", got, pcs[1:])
+	}
+}
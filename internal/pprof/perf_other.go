@@ -0,0 +1,10 @@
+//go:build !linux
+
+package pprof
+
+import "errors"
+
+// NewPerfCollector returns an error: perf events are only supported on Linux.
+func NewPerfCollector(PerfClock, int) (Collector, error) {
+	return nil, errors.New("perf events are only supported on Linux")
+}
@@ -2,6 +2,7 @@ package pprof
 
 import (
 	"io"
+	"runtime"
 	"runtime/pprof"
 	"sync"
 )
@@ -21,11 +22,36 @@ type Collector interface {
 
 func DefaultCollector() Collector { return defaultCollector{} }
 
+// defaultRate is the CPU profiling rate set by pprof.StartCPUProfile.
+const defaultRate = 100
+
+// RateCollector returns a collector that profiles CPU at hz samples per
+// second. The rate is set with runtime.SetCPUProfileRate before the
+// pprof.StartCPUProfile call, which makes the runtime print the "cannot set
+// cpu profile rate" warning to stderr each time the profiling starts.
+func RateCollector(hz int) Collector {
+	if hz <= 0 || hz == defaultRate {
+		return defaultCollector{}
+	}
+
+	return rateCollector(hz)
+}
+
 type defaultCollector struct{}
 
 func (c defaultCollector) StartCPUProfile(w io.Writer) error { return pprof.StartCPUProfile(w) }
 func (c defaultCollector) StopCPUProfile()                   { pprof.StopCPUProfile() }
 
+type rateCollector int
+
+func (c rateCollector) StartCPUProfile(w io.Writer) error {
+	runtime.SetCPUProfileRate(int(c))
+
+	return pprof.StartCPUProfile(w)
+}
+
+func (c rateCollector) StopCPUProfile() { pprof.StopCPUProfile() }
+
 func StartCPUProfile(w io.Writer) error {
 	c.Lock()
 	defer c.Unlock()
@@ -35,3 +35,20 @@ func Test_DefaultCollector(t *testing.T) {
 	}
 	StopCPUProfile()
 }
+
+func Test_RateCollector(t *testing.T) {
+	if _, ok := RateCollector(0).(defaultCollector); !ok {
+		t.Fatal("zero rate must use the default collector")
+	}
+	if _, ok := RateCollector(100).(defaultCollector); !ok {
+		t.Fatal("default rate must use the default collector")
+	}
+	c := RateCollector(250)
+	if err := c.StartCPUProfile(io.Discard); err != nil {
+		t.Fatalf("Rate collector StartCPUProfile: %v", err)
+	}
+	if err := c.StartCPUProfile(io.Discard); err == nil {
+		t.Fatalf("Rate collector must fail on consecutive StartCPUProfile")
+	}
+	c.StopCPUProfile()
+}
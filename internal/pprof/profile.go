@@ -0,0 +1,217 @@
+package pprof
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"time"
+)
+
+// stackProfile aggregates stack samples, taken periodically,
+// and encodes them as a gzipped pprof profile.
+type stackProfile struct {
+	sampleType string // "cpu" or "wall"
+	period     time.Duration
+	start      time.Time
+	samples    map[string]*stackSample
+}
+
+type stackSample struct {
+	stack  []uintptr // return addresses, the innermost frame first
+	labels []string  // key-value pairs
+	count  int64
+}
+
+func newStackProfile(sampleType string, period time.Duration) *stackProfile {
+	return &stackProfile{
+		sampleType: sampleType,
+		period:     period,
+		start:      time.Now(),
+		samples:    make(map[string]*stackSample),
+	}
+}
+
+// add records n samples of the stack of return addresses with the labels,
+// which are key-value pairs.
+func (p *stackProfile) add(stack []uintptr, labels []string, n int64) {
+	key := make([]byte, 0, len(stack)*8)
+	for _, pc := range stack {
+		key = binary.LittleEndian.AppendUint64(key, uint64(pc))
+	}
+	for _, l := range labels {
+		key = append(key, 0)
+		key = append(key, l...)
+	}
+	if s, ok := p.samples[string(key)]; ok {
+		s.count += n
+
+		return
+	}
+	p.samples[string(key)] = &stackSample{
+		stack:  append([]uintptr(nil), stack...),
+		labels: append([]string(nil), labels...),
+		count:  n,
+	}
+}
+
+// pprof Profile message field numbers.
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+)
+
+type profileEncoder struct {
+	strings   map[string]uint64
+	table     []byte
+	locations map[uintptr]uint64
+	frames    map[string]uint64
+	functions map[string]uint64
+	body      []byte
+}
+
+func newProfileEncoder() *profileEncoder {
+	e := &profileEncoder{
+		strings:   make(map[string]uint64),
+		locations: make(map[uintptr]uint64),
+		frames:    make(map[string]uint64),
+		functions: make(map[string]uint64),
+	}
+	e.string("")
+
+	return e
+}
+
+func (p *stackProfile) write(w io.Writer) error {
+	e := newProfileEncoder()
+	sampleTypes := [][2]string{{"samples", "count"}, {p.sampleType, "nanoseconds"}}
+	for _, t := range sampleTypes {
+		e.body = appendBytesField(e.body, profileSampleType, e.valueType(t[0], t[1]))
+	}
+	for _, s := range p.samples {
+		var b []byte
+		ids := make([]byte, 0, len(s.stack))
+		for _, pc := range s.stack {
+			ids = binary.AppendUvarint(ids, e.location(pc))
+		}
+		b = appendBytesField(b, 1, ids)
+		values := binary.AppendUvarint(nil, uint64(s.count))                   //nolint:gosec
+		values = binary.AppendUvarint(values, uint64(s.count*int64(p.period))) //nolint:gosec
+		b = appendBytesField(b, 2, values)
+		for i := 0; i+1 < len(s.labels); i += 2 {
+			label := appendVarintField(nil, 1, e.string(s.labels[i]))
+			label = appendVarintField(label, 2, e.string(s.labels[i+1]))
+			b = appendBytesField(b, 3, label)
+		}
+		e.body = appendBytesField(e.body, profileSample, b)
+	}
+	e.body = appendVarintField(e.body, profileTimeNanos, uint64(p.start.UnixNano()))                    //nolint:gosec
+	e.body = appendVarintField(e.body, profileDurationNanos, uint64(time.Since(p.start).Nanoseconds())) //nolint:gosec
+	e.body = appendBytesField(e.body, profilePeriodType, e.valueType(p.sampleType, "nanoseconds"))
+	e.body = appendVarintField(e.body, profilePeriod, uint64(p.period.Nanoseconds())) //nolint:gosec
+
+	return e.writeTo(w)
+}
+
+// writeTo writes the gzipped profile to w.
+func (e *profileEncoder) writeTo(w io.Writer) error {
+	gw := gzip.NewWriter(w)
+	if _, err := gw.Write(append(e.body, e.table...)); err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+func (e *profileEncoder) string(s string) uint64 {
+	if id, ok := e.strings[s]; ok {
+		return id
+	}
+	id := uint64(len(e.strings))
+	e.strings[s] = id
+	e.table = appendBytesField(e.table, profileStringTable, []byte(s))
+
+	return id
+}
+
+func (e *profileEncoder) valueType(typ, unit string) []byte {
+	b := appendVarintField(nil, 1, e.string(typ))
+
+	return appendVarintField(b, 2, e.string(unit))
+}
+
+// location returns the ID of the location of the return address pc.
+func (e *profileEncoder) location(pc uintptr) uint64 {
+	if id, ok := e.locations[pc]; ok {
+		return id
+	}
+	id := uint64(len(e.locations) + len(e.frames) + 1)
+	e.locations[pc] = id
+	b := appendVarintField(nil, 1, id)
+	b = appendVarintField(b, 3, uint64(pc-1))
+	frames := runtime.CallersFrames([]uintptr{pc})
+	for {
+		f, more := frames.Next()
+		if f.Function != "" {
+			line := appendVarintField(nil, 1, e.function(f.Function, f.File))
+			line = appendVarintField(line, 2, uint64(f.Line)) //nolint:gosec
+			b = appendBytesField(b, 4, line)
+		}
+		if !more {
+			break
+		}
+	}
+	e.body = appendBytesField(e.body, profileLocation, b)
+
+	return id
+}
+
+// frame returns the ID of a location without an address,
+// which consists of the function of the name only.
+func (e *profileEncoder) frame(name string) uint64 {
+	if id, ok := e.frames[name]; ok {
+		return id
+	}
+	id := uint64(len(e.locations) + len(e.frames) + 1)
+	e.frames[name] = id
+	b := appendVarintField(nil, 1, id)
+	b = appendBytesField(b, 4, appendVarintField(nil, 1, e.function(name, "")))
+	e.body = appendBytesField(e.body, profileLocation, b)
+
+	return id
+}
+
+func (e *profileEncoder) function(name, file string) uint64 {
+	if id, ok := e.functions[name]; ok {
+		return id
+	}
+	id := uint64(len(e.functions) + 1)
+	e.functions[name] = id
+	b := appendVarintField(nil, 1, id)
+	b = appendVarintField(b, 2, e.string(name))
+	b = appendVarintField(b, 3, e.string(name))
+	b = appendVarintField(b, 4, e.string(file))
+	e.body = appendBytesField(e.body, profileFunction, b)
+
+	return id
+}
+
+func appendVarintField(b []byte, num, v uint64) []byte {
+	b = binary.AppendUvarint(b, num<<3)
+
+	return binary.AppendUvarint(b, v)
+}
+
+func appendBytesField(b []byte, num uint64, v []byte) []byte {
+	b = binary.AppendUvarint(b, num<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+
+	return append(b, v...)
+}
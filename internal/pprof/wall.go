@@ -0,0 +1,109 @@
+package pprof
+
+import (
+	"io"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// WallProfiler samples the stacks of all goroutines periodically,
+// regardless of whether they are running, blocked or waiting, which
+// shows where the wall-clock time is spent. Each sample is weighted
+// by the sampling interval.
+type WallProfiler struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	profile *stackProfile
+	stop    chan struct{}
+	done    chan struct{}
+
+	// Used by the sampling goroutine only.
+	records []stackRecord
+	labels  []unsafe.Pointer
+	pairs   []string
+}
+
+func NewWallProfiler(interval time.Duration) *WallProfiler {
+	return &WallProfiler{
+		interval: interval,
+		profile:  newStackProfile("wall", interval),
+	}
+}
+
+// Start starts sampling the goroutines.
+func (p *WallProfiler) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop != nil {
+		return
+	}
+	p.profile = newStackProfile("wall", p.interval)
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go p.run(p.stop, p.done)
+}
+
+// Stop stops sampling the goroutines.
+func (p *WallProfiler) Stop() {
+	p.mu.Lock()
+	stop, done := p.stop, p.done
+	p.stop, p.done = nil, nil
+	p.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// Profile writes the profile of the samples taken
+// since the previous call, or since Start.
+func (p *WallProfiler) Profile(w io.Writer) error {
+	p.mu.Lock()
+	profile := p.profile
+	p.profile = newStackProfile("wall", p.interval)
+	p.mu.Unlock()
+
+	return profile.write(w)
+}
+
+func (p *WallProfiler) run(stop, done chan struct{}) {
+	defer close(done)
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			p.sample()
+		}
+	}
+}
+
+// sample adds the stacks of all goroutines, except the sampling
+// goroutine, which the runtime records first, to the profile.
+func (p *WallProfiler) sample() {
+	n, ok := pprof_goroutineProfileWithLabels(p.records, p.labels)
+	for !ok {
+		// Allow for some goroutines to be created between the calls.
+		p.records = make([]stackRecord, n+10)
+		p.labels = make([]unsafe.Pointer, n+10)
+		n, ok = pprof_goroutineProfileWithLabels(p.records, p.labels)
+	}
+	p.mu.Lock()
+	for i := 1; i < n; i++ {
+		p.pairs = p.pairs[:0]
+		if l := p.labels[i]; l != nil {
+			for _, kv := range (*labelMap)(l).List {
+				p.pairs = append(p.pairs, kv.Key, kv.Value)
+			}
+		}
+		p.profile.add(p.records[i].Stack, p.pairs, 1)
+	}
+	p.mu.Unlock()
+	// Do not keep the stacks and labels alive until the next sample.
+	clear(p.records[:n])
+	clear(p.labels[:n])
+}
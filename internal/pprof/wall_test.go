@@ -0,0 +1,49 @@
+package pprof
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_WallProfiler(t *testing.T) {
+	stop := make(chan struct{})
+	go pprof.Do(context.Background(), pprof.Labels("request", "wall-test"), func(context.Context) {
+		wallWait(stop)
+	})
+	defer close(stop)
+
+	p := NewWallProfiler(10 * time.Millisecond)
+	p.Start()
+	time.Sleep(100 * time.Millisecond)
+	p.Stop()
+
+	var buf bytes.Buffer
+	if err := p.Profile(&buf); err != nil {
+		t.Fatalf("WallProfiler Profile: %v", err)
+	}
+	r, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("invalid profile: %v", err)
+	}
+	profile, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("invalid profile: %v", err)
+	}
+	for _, s := range []string{"pprof.wallWait", "wall-test"} {
+		if !strings.Contains(string(profile), s) {
+			t.Fatalf("profile does not contain %q", s)
+		}
+	}
+	if strings.Contains(string(profile), "(*WallProfiler).sample") {
+		t.Fatal("profile contains the sampling goroutine")
+	}
+}
+
+//go:noinline
+func wallWait(stop chan struct{}) { <-stop }
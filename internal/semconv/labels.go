@@ -25,6 +25,11 @@ type versions struct {
 type AppNames struct {
 	SDK         string
 	Godeltaprof string
+
+	// SDKLabels and GodeltaprofLabels hold the label sets
+	// that SDK and Godeltaprof names are built from.
+	SDKLabels         map[string]string
+	GodeltaprofLabels map[string]string
 }
 
 func getScopeVersions() versions {
@@ -91,19 +96,23 @@ func MergeTagsWithAppName(appName string, sid string, tags map[string]string) (A
 	addDefaultLabel(k, labelProcessRuntimeName, getRuntimeName())
 	addDefaultLabel(k, labelProcessRuntimeVersion, getRuntimeVersion())
 	vs := getScopeVersions()
+	sdk := buildAppLabels(k, scopeSDK, vs.sdk)
+	godeltaprof := buildAppLabels(k, scopeGodeltaprof, vs.godeltaprof)
 
 	return AppNames{
-		SDK:         buildAppName(k, scopeSDK, vs.sdk),
-		Godeltaprof: buildAppName(k, scopeGodeltaprof, vs.godeltaprof),
+		SDK:               sdk.Normalized(),
+		Godeltaprof:       godeltaprof.Normalized(),
+		SDKLabels:         sdk.Labels(),
+		GodeltaprofLabels: godeltaprof.Labels(),
 	}, nil
 }
 
-func buildAppName(builder *labelset.LabelSet, scope, version string) string {
+func buildAppLabels(builder *labelset.LabelSet, scope, version string) *labelset.LabelSet {
 	builder = builder.Clone()
 	addDefaultLabel(builder, labelScopeName, scope)
 	addDefaultLabel(builder, labelScopeVersion, version)
 
-	return builder.Normalized()
+	return builder
 }
 
 func addDefaultLabel(builder *labelset.LabelSet, key, value string) {
@@ -83,6 +83,18 @@ func TestMergeTagsWithAppNameTagsOverrideEmbeddedTags(t *testing.T) {
 	}
 }
 
+func TestMergeTagsWithAppNameLabels(t *testing.T) {
+	tags := map[string]string{"foo": "a,b=c}"}
+	names, err := MergeTagsWithAppName("testApp", "239", tags)
+	require.NoError(t, err)
+
+	require.Equal(t, "testApp", names.SDKLabels[labelset.ReservedLabelNameName])
+	require.Equal(t, "a,b=c}", names.SDKLabels["foo"])
+	require.Equal(t, scopeSDK, names.SDKLabels[labelScopeName])
+	require.Equal(t, "a,b=c}", names.GodeltaprofLabels["foo"])
+	require.Equal(t, scopeGodeltaprof, names.GodeltaprofLabels[labelScopeName])
+}
+
 func parseAppName(t *testing.T, name string) map[string]string {
 	t.Helper()
 
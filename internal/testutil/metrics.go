@@ -0,0 +1,51 @@
+package testutil
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/grafana/pyroscope-go/metrics"
+)
+
+// TestMetrics records the values reported with metrics.Metrics.
+type TestMetrics struct {
+	sync.Mutex
+
+	values map[string][]float64
+}
+
+func NewTestMetrics() *TestMetrics {
+	return &TestMetrics{values: make(map[string][]float64)}
+}
+
+func (m *TestMetrics) Counter(d metrics.Desc) metrics.Counter     { return testInstrument{m, d.Name} }
+func (m *TestMetrics) Histogram(d metrics.Desc) metrics.Histogram { return testInstrument{m, d.Name} }
+func (m *TestMetrics) Gauge(d metrics.Desc) metrics.Gauge         { return testInstrument{m, d.Name} }
+
+// Values returns the values recorded for the metric name and label values.
+func (m *TestMetrics) Values(name string, labelValues ...string) []float64 {
+	m.Lock()
+	defer m.Unlock()
+
+	return append([]float64(nil), m.values[key(name, labelValues)]...)
+}
+
+func (m *TestMetrics) put(name string, v float64, labelValues []string) {
+	m.Lock()
+	k := key(name, labelValues)
+	m.values[k] = append(m.values[k], v)
+	m.Unlock()
+}
+
+func key(name string, labelValues []string) string {
+	return strings.Join(append([]string{name}, labelValues...), ",")
+}
+
+type testInstrument struct {
+	m    *TestMetrics
+	name string
+}
+
+func (i testInstrument) Add(v float64, labelValues ...string)     { i.m.put(i.name, v, labelValues) }
+func (i testInstrument) Observe(v float64, labelValues ...string) { i.m.put(i.name, v, labelValues) }
+func (i testInstrument) Set(v float64, labelValues ...string)     { i.m.put(i.name, v, labelValues) }
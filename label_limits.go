@@ -0,0 +1,72 @@
+package pyroscope
+
+import (
+	"github.com/grafana/pyroscope-go/internal/labelguard"
+	"github.com/grafana/pyroscope-go/internal/logging"
+	"github.com/grafana/pyroscope-go/upstream"
+)
+
+// LabelLimits limits the cardinality of the labels of the CPU, wall and
+// goroutine profiles. The limits apply to each uploaded profile: label
+// values over the limit are replaced with "__other__" before the upload.
+type LabelLimits struct {
+	// MaxValuesPerKey limits the number of distinct values of a label key
+	// in a profile; zero means no limit. The values with the most samples
+	// are kept.
+	MaxValuesPerKey int
+	// PerKey overrides MaxValuesPerKey for specific keys.
+	PerKey map[string]int
+	// AllowedKeys, if not empty, lists the only label keys kept.
+	AllowedKeys []string
+	// DeniedKeys lists the label keys removed from the profiles.
+	DeniedKeys []string
+}
+
+// labelGuardUpstream applies the label limits to the profiles with labels.
+type labelGuardUpstream struct {
+	upstream.Upstream
+
+	limits labelguard.Limits
+	logger *logging.Logger
+}
+
+func newLabelGuardUpstream(u upstream.Upstream, l LabelLimits, logger *logging.Logger) upstream.Upstream {
+	limits := labelguard.Limits{
+		MaxValuesPerKey: l.MaxValuesPerKey,
+		PerKey:          l.PerKey,
+		AllowedKeys:     l.AllowedKeys,
+		DeniedKeys:      l.DeniedKeys,
+	}
+	if !limits.Enabled() {
+		return u
+	}
+
+	return &labelGuardUpstream{Upstream: u, limits: limits, logger: logger}
+}
+
+func (u *labelGuardUpstream) Upload(j *upstream.UploadJob) {
+	switch j.ProfileName {
+	case upstream.ProfileNameCPU, upstream.ProfileNameWall,
+		upstream.ProfileNameGoroutine, upstream.ProfileNameGoroutineLeak:
+	default:
+		u.Upstream.Upload(j)
+
+		return
+	}
+	profile, overflows, err := labelguard.Apply(j.Profile, u.limits)
+	if err != nil {
+		u.logger.Error("failed to apply label limits", "profile_type", j.ProfileName, "err", err)
+		u.Upstream.Upload(j)
+
+		return
+	}
+	for _, o := range overflows {
+		u.logger.Warn("label values over the limit replaced with "+labelguard.OtherValue,
+			"profile_type", j.ProfileName, "key", o.Key, "values", o.Values, "limit", o.Limit)
+	}
+	// The job may be shared with other upstreams, such as the fan-out
+	// destinations, which must get the profile they were given.
+	c := *j
+	c.Profile = profile
+	u.Upstream.Upload(&c)
+}
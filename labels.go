@@ -0,0 +1,72 @@
+package pyroscope
+
+import (
+	"context"
+	"runtime/pprof"
+	"unsafe"
+)
+
+// Go runs fn in a new goroutine labeled with the labels of ctx. Unlike the
+// go statement, which copies the labels of the calling goroutine, Go takes
+// the labels from the context, so they are not lost if the calling
+// goroutine is not labeled, for example because it runs on behalf of a
+// different context.
+func Go(ctx context.Context, fn func(context.Context)) {
+	go func() {
+		pprof.SetGoroutineLabels(ctx)
+		fn(ctx)
+	}()
+}
+
+// WithLabelsFromContext returns a function that calls fn with the labels
+// of ctx set on the calling goroutine. It is meant for tasks submitted to
+// worker pools and task queues, whose goroutines are started before the
+// tasks, and therefore do not inherit the labels of the submitter. Once fn
+// returns, the previous goroutine labels are restored, as with pprof.Do.
+func WithLabelsFromContext(ctx context.Context, fn func(context.Context)) func() {
+	return func() {
+		defer runtime_setProfLabel(runtime_getProfLabel())
+		pprof.SetGoroutineLabels(ctx)
+		fn(ctx)
+	}
+}
+
+// The runtime/pprof package provides no getter of the goroutine labels,
+// which are needed to restore them without a context.
+
+//go:linkname runtime_getProfLabel runtime/pprof.runtime_getProfLabel
+func runtime_getProfLabel() unsafe.Pointer
+
+//go:linkname runtime_setProfLabel runtime/pprof.runtime_setProfLabel
+func runtime_setProfLabel(labels unsafe.Pointer)
+
+// Group is a group of goroutines, such as errgroup.Group.
+type Group interface {
+	Go(fn func() error)
+}
+
+// GroupWithLabels wraps g so that functions started with Go run with the
+// labels of ctx. Use the wrapped group to wait for the goroutines:
+//
+//	g, ctx := errgroup.WithContext(ctx)
+//	lg := pyroscope.GroupWithLabels(ctx, g)
+//	for _, task := range tasks {
+//		lg.Go(func() error { return task.Run(ctx) })
+//	}
+//	err := g.Wait()
+func GroupWithLabels(ctx context.Context, g Group) Group {
+	return &labeledGroup{g: g, ctx: ctx}
+}
+
+type labeledGroup struct {
+	g   Group
+	ctx context.Context //nolint:containedctx
+}
+
+func (g *labeledGroup) Go(fn func() error) {
+	g.g.Go(func() error {
+		pprof.SetGoroutineLabels(g.ctx)
+
+		return fn()
+	})
+}
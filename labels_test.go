@@ -0,0 +1,80 @@
+package pyroscope
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errTask = errors.New("task failed")
+
+// labeledGoroutines returns the number of goroutines
+// labeled with the tenant label of the given value.
+func labeledGoroutines(t *testing.T, tenant string) int {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, pprof.Lookup("goroutine").WriteTo(&buf, 1))
+
+	return strings.Count(buf.String(), `# labels: {"tenant":"`+tenant+`"}`)
+}
+
+func TestGo(t *testing.T) {
+	ctx := pprof.WithLabels(context.Background(), Labels("tenant", "go"))
+	done := make(chan int)
+	Go(ctx, func(context.Context) { done <- labeledGoroutines(t, "go") })
+	assert.Equal(t, 1, <-done)
+}
+
+func TestWithLabelsFromContext(t *testing.T) {
+	tasks := make(chan func())
+	results := make(chan int)
+	// The worker is started before the task is submitted.
+	Go(pprof.WithLabels(context.Background(), Labels("tenant", "worker")), func(context.Context) {
+		(<-tasks)()
+		results <- labeledGoroutines(t, "task")
+		results <- labeledGoroutines(t, "worker")
+	})
+
+	ctx := pprof.WithLabels(context.Background(), Labels("tenant", "task"))
+	tasks <- WithLabelsFromContext(ctx, func(context.Context) {
+		results <- labeledGoroutines(t, "task")
+	})
+	assert.Equal(t, 1, <-results)
+	// The worker labels are restored once the task is done.
+	assert.Equal(t, 0, <-results)
+	assert.Equal(t, 1, <-results)
+}
+
+type testGroup struct {
+	wg  sync.WaitGroup
+	err error
+}
+
+func (g *testGroup) Go(fn func() error) {
+	g.wg.Go(func() {
+		if err := fn(); err != nil {
+			g.err = err
+		}
+	})
+}
+
+func TestGroupWithLabels(t *testing.T) {
+	ctx := pprof.WithLabels(context.Background(), Labels("tenant", "group"))
+	g := new(testGroup)
+	GroupWithLabels(ctx, g).Go(func() error {
+		if labeledGoroutines(t, "group") != 1 {
+			return errTask
+		}
+
+		return nil
+	})
+	g.wg.Wait()
+	assert.NoError(t, g.err)
+}
@@ -1,6 +1,11 @@
 package pyroscope
 
-import "fmt"
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/grafana/pyroscope-go/internal/logging"
+)
 
 // these loggers implement the types.Logger interface
 
@@ -26,3 +31,11 @@ var (
 	noopLogger     = &noopLoggerImpl{}     //nolint:gochecknoglobals
 	StandardLogger = &standardLoggerImpl{} //nolint:gochecknoglobals
 )
+
+// NewSlogLogger returns a Logger writing to l. Unlike other loggers, it
+// receives messages with levels, including warnings, and key/value
+// attributes, such as the profile type, instead of formatted strings.
+// The logger can also be passed to upstreams, such as remote.Remote.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return logging.NewSlogAdapter(l)
+}
@@ -0,0 +1,126 @@
+// Package metrics defines the metrics the profiler reports about itself,
+// and the interface a metrics backend implements to receive them.
+//
+// The SDK does not depend on a metrics library: adapters for Prometheus
+// and OpenTelemetry are provided by the x/prommetrics and x/otelmetrics
+// modules.
+package metrics
+
+// Metrics creates the instruments the profiler reports its metrics with.
+// Instruments may be requested multiple times with the same Desc, for
+// example by every upstream, and the implementation is expected to return
+// the same instrument, or an instrument sharing the same data.
+type Metrics interface {
+	Counter(d Desc) Counter
+	Histogram(d Desc) Histogram
+	Gauge(d Desc) Gauge
+}
+
+// Desc describes a metric. Label values are passed to the instrument
+// methods in the order of Labels.
+type Desc struct {
+	Name   string
+	Help   string
+	Labels []string
+	// Buckets are the suggested histogram bucket boundaries.
+	Buckets []float64
+}
+
+type Counter interface {
+	Add(v float64, labelValues ...string)
+}
+
+type Histogram interface {
+	Observe(v float64, labelValues ...string)
+}
+
+type Gauge interface {
+	Set(v float64, labelValues ...string)
+}
+
+// Label names.
+const (
+	LabelProfileType = "profile_type"
+	LabelResult      = "result"
+	LabelReason      = "reason"
+	LabelDestination = "destination"
+)
+
+// Values of the result label.
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+// Values of the reason label of DroppedProfiles.
+const (
+	ReasonQueueFull    = "queue_full"
+	ReasonUploadFailed = "upload_failed"
+	ReasonSpoolFailed  = "spool_failed"
+)
+
+// The metrics reported by the profiler. The profile type label holds
+// upstream.UploadJob.ProfileName values, the destination label the
+// server address, without credentials.
+//
+//nolint:gochecknoglobals
+var (
+	Uploads = Desc{
+		Name:   "pyroscope_uploads_total",
+		Help:   "Number of profile upload requests.",
+		Labels: []string{LabelProfileType, LabelResult, LabelDestination},
+	}
+	UploadDuration = Desc{
+		Name:    "pyroscope_upload_duration_seconds",
+		Help:    "Duration of profile upload requests.",
+		Labels:  []string{LabelProfileType, LabelDestination},
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}
+	DroppedProfiles = Desc{
+		Name:   "pyroscope_dropped_profiles_total",
+		Help:   "Number of profiles dropped without being uploaded.",
+		Labels: []string{LabelProfileType, LabelReason, LabelDestination},
+	}
+	QueueLength = Desc{
+		Name:   "pyroscope_upload_queue_length",
+		Help:   "Number of profiles waiting in the upload queue.",
+		Labels: []string{LabelDestination},
+	}
+	ProfileSize = Desc{
+		Name:    "pyroscope_profile_size_bytes",
+		Help:    "Size of the collected profiles.",
+		Labels:  []string{LabelProfileType},
+		Buckets: []float64{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20},
+	}
+	CollectDuration = Desc{
+		Name:    "pyroscope_profile_collect_duration_seconds",
+		Help:    "Time spent collecting profiles.",
+		Labels:  []string{LabelProfileType},
+		Buckets: []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+	}
+	ForcedGC = Desc{
+		Name: "pyroscope_forced_gc_total",
+		Help: "Number of garbage collections forced to collect a heap profile.",
+	}
+)
+
+// OrNoop returns m, or a no-op implementation if m is nil.
+func OrNoop(m Metrics) Metrics {
+	if m == nil {
+		return Noop
+	}
+
+	return m
+}
+
+// Noop discards all the metrics.
+var Noop Metrics = noop{} //nolint:gochecknoglobals
+
+type noop struct{}
+
+func (noop) Counter(Desc) Counter       { return noop{} }
+func (noop) Histogram(Desc) Histogram   { return noop{} }
+func (noop) Gauge(Desc) Gauge           { return noop{} }
+func (noop) Add(float64, ...string)     {}
+func (noop) Observe(float64, ...string) {}
+func (noop) Set(float64, ...string)     {}
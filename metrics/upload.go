@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"net/url"
+	"time"
+)
+
+// UploadMetrics are the metrics reported by upstreams.
+type UploadMetrics struct {
+	Uploads         Counter
+	UploadDuration  Histogram
+	DroppedProfiles Counter
+	QueueLength     Gauge
+
+	destination string
+}
+
+// NewUploadMetrics creates the metrics of the upstream uploading
+// to the address; m may be nil.
+func NewUploadMetrics(m Metrics, address string) *UploadMetrics {
+	m = OrNoop(m)
+
+	return &UploadMetrics{
+		Uploads:         m.Counter(Uploads),
+		UploadDuration:  m.Histogram(UploadDuration),
+		DroppedProfiles: m.Counter(DroppedProfiles),
+		QueueLength:     m.Gauge(QueueLength),
+		destination:     destination(address),
+	}
+}
+
+// destination returns the address without the credentials and the query.
+func destination(address string) string {
+	u, err := url.Parse(address)
+	if err != nil {
+		return ""
+	}
+	u.User, u.RawQuery, u.Fragment = nil, "", ""
+
+	return u.String()
+}
+
+// SetQueueLength records the number of profiles in the upload queue.
+func (u *UploadMetrics) SetQueueLength(n int) {
+	u.QueueLength.Set(float64(n), u.destination)
+}
+
+// ObserveUpload records an upload request started at start.
+func (u *UploadMetrics) ObserveUpload(profileType string, start time.Time, err error) {
+	u.UploadDuration.Observe(time.Since(start).Seconds(), profileType, u.destination)
+	result := ResultSuccess
+	if err != nil {
+		result = ResultError
+	}
+	u.Uploads.Add(1, profileType, result, u.destination)
+}
+
+// Dropped records a profile dropped for the reason.
+func (u *UploadMetrics) Dropped(profileType, reason string) {
+	u.DroppedProfiles.Add(1, profileType, reason, u.destination)
+}
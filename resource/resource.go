@@ -0,0 +1,191 @@
+// Package resource detects attributes of the environment the application
+// runs in, such as the Kubernetes pod or the application version, to be
+// added to profiles as tags. Attribute names follow the OpenTelemetry
+// resource semantic conventions.
+package resource
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"strings"
+)
+
+const (
+	AttrK8sPodName       = "k8s.pod.name"
+	AttrK8sNamespaceName = "k8s.namespace.name"
+	AttrK8sNodeName      = "k8s.node.name"
+	AttrK8sContainerName = "k8s.container.name"
+	AttrContainerID      = "container.id"
+	AttrHostName         = "host.name"
+	AttrServiceVersion   = "service.version"
+	// AttrGitRef is the label Pyroscope uses to link profiles with the
+	// source code; it holds the VCS revision the binary was built from.
+	AttrGitRef = "service_git_ref"
+)
+
+//nolint:gochecknoglobals
+var (
+	cgroupPath    = "/proc/self/cgroup"
+	namespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	hostname      = os.Hostname
+	readBuildInfo = debug.ReadBuildInfo
+
+	containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+)
+
+// Detector detects resource attributes. Attributes that can
+// not be detected are omitted, and are not reported as errors.
+type Detector interface {
+	Detect() (map[string]string, error)
+}
+
+// DetectorFunc is a function implementing Detector.
+type DetectorFunc func() (map[string]string, error)
+
+func (f DetectorFunc) Detect() (map[string]string, error) { return f() }
+
+// Default returns all the detectors of the package.
+func Default() []Detector {
+	return []Detector{Kubernetes(), Container(), Host(), BuildInfo()}
+}
+
+// Detect runs the detectors and merges the detected attributes; attributes
+// of the latter detectors take precedence. Errors of all the detectors are
+// returned along with the attributes detected successfully.
+func Detect(detectors ...Detector) (map[string]string, error) {
+	attrs := make(map[string]string)
+	var errs []error
+	for _, d := range detectors {
+		m, err := d.Detect()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for k, v := range m {
+			if v != "" {
+				attrs[k] = v
+			}
+		}
+	}
+
+	return attrs, errors.Join(errs...)
+}
+
+// Kubernetes detects the pod name, namespace, node and container name
+// from the environment variables that are expected to be set with the
+// downward API:
+//
+//	env:
+//	  - name: POD_NAME
+//	    valueFrom: {fieldRef: {fieldPath: metadata.name}}
+//	  - name: POD_NAMESPACE
+//	    valueFrom: {fieldRef: {fieldPath: metadata.namespace}}
+//	  - name: NODE_NAME
+//	    valueFrom: {fieldRef: {fieldPath: spec.nodeName}}
+//	  - name: CONTAINER_NAME
+//	    value: app
+//
+// The K8S_ prefixed variants, like K8S_POD_NAME, are recognized as well.
+// Outside Kubernetes, which is recognized by the absence of the
+// KUBERNETES_SERVICE_HOST variable, nothing is detected. Without the
+// variables, the pod name defaults to the host name and the namespace is
+// read from the service account.
+func Kubernetes() Detector {
+	return DetectorFunc(func() (map[string]string, error) {
+		if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+			return nil, nil //nolint:nilnil
+		}
+		attrs := map[string]string{
+			AttrK8sPodName:       getenv("POD_NAME", "K8S_POD_NAME"),
+			AttrK8sNamespaceName: getenv("POD_NAMESPACE", "K8S_NAMESPACE_NAME"),
+			AttrK8sNodeName:      getenv("NODE_NAME", "K8S_NODE_NAME"),
+			AttrK8sContainerName: getenv("CONTAINER_NAME", "K8S_CONTAINER_NAME"),
+		}
+		if attrs[AttrK8sPodName] == "" {
+			attrs[AttrK8sPodName], _ = hostname()
+		}
+		if attrs[AttrK8sNamespaceName] == "" {
+			b, err := os.ReadFile(namespacePath)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return attrs, err
+			}
+			attrs[AttrK8sNamespaceName] = strings.TrimSpace(string(b))
+		}
+
+		return attrs, nil
+	})
+}
+
+// Container detects the container ID from /proc/self/cgroup.
+func Container() Detector {
+	return DetectorFunc(func() (map[string]string, error) {
+		f, err := os.Open(cgroupPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil //nolint:nilnil
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			// hierarchy-ID:controller-list:cgroup-path
+			_, path, _ := strings.Cut(s.Text(), ":")
+			_, path, _ = strings.Cut(path, ":")
+			if id := containerIDPattern.FindString(path); id != "" {
+				return map[string]string{AttrContainerID: id}, nil
+			}
+		}
+
+		return nil, s.Err()
+	})
+}
+
+// Host detects the host name.
+func Host() Detector {
+	return DetectorFunc(func() (map[string]string, error) {
+		name, err := hostname()
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]string{AttrHostName: name}, nil
+	})
+}
+
+// BuildInfo detects the application version and the VCS revision
+// embedded in the binary by the go command.
+func BuildInfo() Detector {
+	return DetectorFunc(func() (map[string]string, error) {
+		info, ok := readBuildInfo()
+		if !ok {
+			return nil, nil //nolint:nilnil
+		}
+		attrs := make(map[string]string)
+		if v := info.Main.Version; v != "" && v != "(devel)" {
+			attrs[AttrServiceVersion] = v
+		}
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				attrs[AttrGitRef] = s.Value
+			}
+		}
+
+		return attrs, nil
+	})
+}
+
+func getenv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,92 @@
+package resource
+
+import (
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testContainerID = "7be92808767a667f35c8505cbf40d14e931ef6db5b0210329cf193b15ba9d605"
+
+func TestKubernetes(t *testing.T) {
+	dir := t.TempDir()
+	namespacePath = filepath.Join(dir, "namespace")
+	hostname = func() (string, error) { return "my-app-7d4b9c-x2x5z", nil }
+	t.Cleanup(func() {
+		namespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+		hostname = os.Hostname
+	})
+	require.NoError(t, os.WriteFile(namespacePath, []byte("prod\n"), 0o600))
+
+	for _, k := range []string{
+		"KUBERNETES_SERVICE_HOST", "POD_NAME", "K8S_POD_NAME", "POD_NAMESPACE", "K8S_NAMESPACE_NAME",
+		"NODE_NAME", "K8S_NODE_NAME", "CONTAINER_NAME", "K8S_CONTAINER_NAME",
+	} {
+		t.Setenv(k, "")
+	}
+	attrs, err := Kubernetes().Detect()
+	require.NoError(t, err)
+	assert.Empty(t, attrs)
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+	t.Setenv("K8S_NODE_NAME", "node-1")
+	attrs, err = Detect(Kubernetes())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		AttrK8sPodName:       "my-app-7d4b9c-x2x5z",
+		AttrK8sNamespaceName: "prod",
+		AttrK8sNodeName:      "node-1",
+	}, attrs)
+
+	t.Setenv("POD_NAME", "my-app")
+	t.Setenv("POD_NAMESPACE", "dev")
+	attrs, err = Detect(Kubernetes())
+	require.NoError(t, err)
+	assert.Equal(t, "my-app", attrs[AttrK8sPodName])
+	assert.Equal(t, "dev", attrs[AttrK8sNamespaceName])
+}
+
+func TestContainer(t *testing.T) {
+	for _, cgroup := range []string{
+		// cgroup v1
+		"12:memory:/kubepods/burstable/pod1b2c/" + testContainerID + "\n1:name=systemd:/kubepods\n",
+		// cgroup v2
+		"0::/system.slice/docker-" + testContainerID + ".scope\n",
+	} {
+		cgroupPath = filepath.Join(t.TempDir(), "cgroup")
+		require.NoError(t, os.WriteFile(cgroupPath, []byte(cgroup), 0o600))
+		attrs, err := Container().Detect()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{AttrContainerID: testContainerID}, attrs)
+	}
+
+	cgroupPath = filepath.Join(t.TempDir(), "missing")
+	t.Cleanup(func() { cgroupPath = "/proc/self/cgroup" })
+	attrs, err := Container().Detect()
+	require.NoError(t, err)
+	assert.Empty(t, attrs)
+}
+
+func TestBuildInfo(t *testing.T) {
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{
+			Main: debug.Module{Path: "example.com/app", Version: "v1.2.3"},
+			Settings: []debug.BuildSetting{
+				{Key: "vcs", Value: "git"},
+				{Key: "vcs.revision", Value: "a1b2c3"},
+			},
+		}, true
+	}
+	t.Cleanup(func() { readBuildInfo = debug.ReadBuildInfo })
+
+	attrs, err := BuildInfo().Detect()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		AttrServiceVersion: "v1.2.3",
+		AttrGitRef:         "a1b2c3",
+	}, attrs)
+}
@@ -0,0 +1,122 @@
+package pyroscope
+
+import (
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/grafana/pyroscope-go/internal/logging"
+)
+
+// blockProfileRate is the rate last set with setRuntimeRates: unlike the
+// mutex profile fraction and MemProfileRate, the runtime block profile
+// rate can not be read back.
+var blockProfileRate atomic.Int64 //nolint:gochecknoglobals
+
+// runtimeRates holds the runtime profiling rates that are
+// applied by Start and Reconfigure, and restored by Stop.
+type runtimeRates struct {
+	mu sync.Mutex
+
+	mutexProfileFraction int
+	blockProfileRate     int
+	memProfileRate       int
+}
+
+// setRuntimeRates sets the non-zero runtime profiling rates from the
+// config, and returns the rates to restore.
+func setRuntimeRates(cfg Config) *runtimeRates {
+	prev := &runtimeRates{
+		mutexProfileFraction: -1,
+		blockProfileRate:     -1,
+		memProfileRate:       -1,
+	}
+	prev.update(cfg.MutexProfileFraction, cfg.BlockProfileRate)
+	if cfg.MemProfileRate != 0 {
+		prev.memProfileRate = runtime.MemProfileRate
+		runtime.MemProfileRate = cfg.MemProfileRate
+	}
+
+	return prev
+}
+
+// update sets the non-zero mutex profile fraction and block profile rate,
+// and returns a function setting back the rates replaced. The rates to
+// restore are the ones before they were first set.
+func (r *runtimeRates) update(mutexProfileFraction, rate int) (undo func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prevMutex, prevRate := -1, -1
+	if mutexProfileFraction != 0 {
+		prevMutex = runtime.SetMutexProfileFraction(mutexProfileFraction)
+		if r.mutexProfileFraction < 0 {
+			r.mutexProfileFraction = prevMutex
+		}
+	}
+	if rate != 0 {
+		prevRate = int(blockProfileRate.Swap(int64(rate)))
+		runtime.SetBlockProfileRate(rate)
+		if r.blockProfileRate < 0 {
+			r.blockProfileRate = prevRate
+		}
+	}
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if prevMutex >= 0 {
+			runtime.SetMutexProfileFraction(prevMutex)
+		}
+		if prevRate >= 0 {
+			blockProfileRate.Store(int64(prevRate))
+			runtime.SetBlockProfileRate(prevRate)
+		}
+	}
+}
+
+func (r *runtimeRates) restore() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mutexProfileFraction >= 0 {
+		runtime.SetMutexProfileFraction(r.mutexProfileFraction)
+	}
+	if r.blockProfileRate >= 0 {
+		blockProfileRate.Store(int64(r.blockProfileRate))
+		runtime.SetBlockProfileRate(r.blockProfileRate)
+	}
+	if r.memProfileRate >= 0 {
+		runtime.MemProfileRate = r.memProfileRate
+	}
+}
+
+// warnZeroRates reports profile types that are enabled but
+// produce empty profiles, because their runtime rate is zero.
+func warnZeroRates(logger *logging.Logger, types []ProfileType) {
+	enabled := func(tt ...ProfileType) bool {
+		for _, t := range tt {
+			if slices.Contains(types, t) {
+				return true
+			}
+		}
+
+		return false
+	}
+	if enabled(ProfileMutexCount, ProfileMutexDuration) && runtime.SetMutexProfileFraction(-1) == 0 {
+		logger.Warn("mutex profiling is enabled, but the mutex profile fraction is zero: " +
+			"set Config.MutexProfileFraction or call runtime.SetMutexProfileFraction")
+	}
+	// The rate is unknown if it was set with runtime.SetBlockProfileRate
+	// directly, then existing records are the only evidence.
+	if enabled(ProfileBlockCount, ProfileBlockDuration) &&
+		blockProfileRate.Load() == 0 && pprof.Lookup("block").Count() == 0 {
+		logger.Warn("block profiling is enabled, but the block profile rate may be zero: " +
+			"set Config.BlockProfileRate or call runtime.SetBlockProfileRate")
+	}
+	if enabled(ProfileInuseObjects, ProfileAllocObjects, ProfileInuseSpace, ProfileAllocSpace) &&
+		runtime.MemProfileRate == 0 {
+		logger.Warn("memory profiling is enabled, but runtime.MemProfileRate is zero: " +
+			"set Config.MemProfileRate")
+	}
+}
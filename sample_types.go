@@ -56,4 +56,21 @@ var (
 			Aggregation: "average",
 		},
 	}
+	sampleTypeConfigThreadCreate = map[string]*upstream.SampleType{ //nolint:gochecknoglobals
+		"threadcreate": {
+			DisplayName: "threads_created",
+			Units:       "threads",
+			Aggregation: "average",
+		},
+	}
+	sampleTypeConfigRuntimeMetrics = map[string]*upstream.SampleType{ //nolint:gochecknoglobals
+		"events": {
+			DisplayName: "runtime_metrics_count",
+			Units:       "events",
+		},
+		"delay": {
+			DisplayName: "runtime_metrics_duration",
+			Units:       "nanoseconds",
+		},
+	}
 )
@@ -2,20 +2,28 @@ package pyroscope
 
 import (
 	"bytes"
+	"errors"
+	"io"
+	"maps"
 	"math"
 	"runtime"
 	"runtime/debug"
 	"runtime/pprof"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/grafana/pyroscope-go/godeltaprof"
+	"github.com/grafana/pyroscope-go/internal/labelset"
+	"github.com/grafana/pyroscope-go/internal/logging"
+	internal "github.com/grafana/pyroscope-go/internal/pprof"
 	"github.com/grafana/pyroscope-go/internal/semconv"
+	"github.com/grafana/pyroscope-go/metrics"
 	"github.com/grafana/pyroscope-go/upstream"
 )
 
 type Session struct {
-	// configuration, doesn't change
+	// configuration, changed only with Reconfigure
 	upstream      upstream.Upstream
 	profileTypes  []ProfileType
 	uploadRate    time.Duration
@@ -23,11 +31,16 @@ type Session struct {
 	// Deprecated: the field will be removed in future releases.
 	DisableAutomaticResets bool
 
-	logger   Logger
-	stopOnce sync.Once
-	stopCh   chan struct{}
-	wg       sync.WaitGroup
-	flushCh  chan *flush
+	logger      *logging.Logger
+	stopOnce    sync.Once
+	stopCh      chan struct{}
+	wg          sync.WaitGroup
+	flushCh     chan *flush
+	reconfigCh  chan *reconfig
+	appName     string
+	sessionID   sessionID
+	runtimeMu   sync.Mutex
+	runtimeConf RuntimeConfig
 
 	// these things do change:
 	memBuf *bytes.Buffer
@@ -36,17 +49,38 @@ type Session struct {
 	goroutineLeakBuf *bytes.Buffer
 	mutexBuf         *bytes.Buffer
 	blockBuf         *bytes.Buffer
+	wallBuf          *bytes.Buffer
+	threadsBuf       *bytes.Buffer
+	metricsBuf       *bytes.Buffer
 
 	lastGCGeneration uint32
+	windowsWithoutGC int
+	heapGC           HeapGCPolicy
 	appNames         semconv.AppNames
 	startTime        time.Time
 
 	deltaBlock *godeltaprof.BlockProfiler
 	deltaMutex *godeltaprof.BlockProfiler
 	deltaHeap  *godeltaprof.HeapProfiler
+	goroutines *godeltaprof.GoroutineProfiler
 	cpu        *cpuProfileCollector
+	wall       *internal.WallProfiler
+	splitCPUBy []string
+	sampleRate uint32
+	// cpuCollector collects the CPU profiles of cpu.
+	cpuCollector internal.Collector
+
+	runtimeMetrics *internal.RuntimeMetricsProfiler
+
+	collectDuration metrics.Histogram
+	forcedGC        metrics.Counter
 }
 
+// wallSampleInterval is the interval between the samples of the wall
+// profile. Each sample takes a goroutine profile, so the overhead grows
+// with the number of goroutines.
+const wallSampleInterval = 50 * time.Millisecond
+
 type SessionConfig struct {
 	Upstream       upstream.Upstream
 	Logger         Logger
@@ -55,6 +89,24 @@ type SessionConfig struct {
 	ProfilingTypes []ProfileType
 	DisableGCRuns  bool
 	UploadRate     time.Duration
+	Metrics        metrics.Metrics // optional
+	LabelLimits    LabelLimits     // optional
+	// SplitCPUProfileBy lists the pprof label keys the CPU profile is
+	// split by, see Config.SplitCPUProfileBy. Optional.
+	SplitCPUProfileBy []string
+	// SampleRate is the CPU profiling rate in samples per second,
+	// DefaultSampleRate if zero. See Config.SampleRate.
+	SampleRate uint32
+	// CPUProfiler selects how CPU profiles are collected, see Config.CPUProfiler.
+	CPUProfiler CPUProfiler
+	// HeapGC limits the GCs forced for heap profiles, see Config.HeapGC.
+	HeapGC HeapGCPolicy
+	// GoroutineStateLabels labels the goroutine profiles with the goroutine
+	// states, see Config.GoroutineStateLabels.
+	GoroutineStateLabels bool
+	// ProfileCompression is the compression of the heap, mutex, block and
+	// goroutine profiles, gzip by default. The upstream must support it.
+	ProfileCompression godeltaprof.Compression
 
 	// Deprecated: the field will be removed in future releases.
 	// Use UploadRate instead.
@@ -62,9 +114,20 @@ type SessionConfig struct {
 	// Deprecated: the field will be removed in future releases.
 	// DisableCumulativeMerge is ignored.
 	DisableCumulativeMerge bool
-	// Deprecated: the field will be removed in future releases.
-	// SampleRate is set to 100 and is not configurable.
-	SampleRate uint32
+}
+
+// RuntimeConfig holds the settings of a running profiling session
+// that can be changed with Reconfigure.
+type RuntimeConfig struct {
+	ProfileTypes  []ProfileType
+	UploadRate    time.Duration
+	Tags          map[string]string
+	DisableGCRuns bool
+	// MutexProfileFraction and BlockProfileRate, if not zero, are applied
+	// to the runtime by Profiler.Reconfigure, see Config.MutexProfileFraction.
+	// Session.Reconfigure ignores them.
+	MutexProfileFraction int
+	BlockProfileRate     int
 }
 
 type flush struct {
@@ -72,34 +135,58 @@ type flush struct {
 	wait bool
 }
 
+type reconfig struct {
+	RuntimeConfig
+
+	appNames semconv.AppNames
+	done     chan struct{}
+}
+
 func NewSession(c SessionConfig) (*Session, error) {
 	if c.UploadRate == 0 {
 		// For backward compatibility.
 		c.UploadRate = 15 * time.Second
 	}
 
-	c.Logger.Infof("starting profiling session:")
-	c.Logger.Infof("  AppName:        %+v", c.AppName)
-	c.Logger.Infof("  Tags:           %+v", c.Tags)
-	c.Logger.Infof("  ProfilingTypes: %+v", c.ProfilingTypes)
-	c.Logger.Infof("  DisableGCRuns:  %+v", c.DisableGCRuns)
-	c.Logger.Infof("  UploadRate:     %+v", c.UploadRate)
+	logger := logging.New(c.Logger)
+	logger.Info("starting profiling session",
+		"app_name", c.AppName,
+		"tags", c.Tags,
+		"profile_types", c.ProfilingTypes,
+		"disable_gc_runs", c.DisableGCRuns,
+		"upload_rate", c.UploadRate)
+
+	if c.SampleRate == 0 {
+		c.SampleRate = DefaultSampleRate
+	}
 
 	if c.DisableAutomaticResets {
 		c.UploadRate = math.MaxInt64
 	}
 
-	appNames, err := semconv.MergeTagsWithAppName(c.AppName, newSessionID().String(), c.Tags)
+	sid := newSessionID()
+	appNames, err := semconv.MergeTagsWithAppName(c.AppName, sid.String(), c.Tags)
 	if err != nil {
 		return nil, err
 	}
 
+	for _, k := range c.SplitCPUProfileBy {
+		if err = labelset.ValidateLabelName(k); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.SplitCPUProfileBy) > 0 && c.CPUProfiler != CPUProfilerRuntime {
+		return nil, errPerfSplitCPUProfile
+	}
+
+	warnZeroRates(logger, c.ProfilingTypes)
+
 	// Warn if goroutine leak profiling is requested but not available.
 	// The goroutineleak profile requires Go 1.26+ with GOEXPERIMENT=goroutineleakprofile.
 	for _, pt := range c.ProfilingTypes {
 		if pt == ProfileGoroutineLeak {
 			if pprof.Lookup("goroutineleak") == nil {
-				c.Logger.Infof("goroutine leak profiling requested but not available: " +
+				logger.Warn("goroutine leak profiling requested but not available: " +
 					"build with GOEXPERIMENT=goroutineleakprofile (requires Go 1.26+)")
 			}
 
@@ -107,26 +194,59 @@ func NewSession(c SessionConfig) (*Session, error) {
 		}
 	}
 
+	m := metrics.OrNoop(c.Metrics)
+	c.Upstream = &meteredUpstream{Upstream: c.Upstream, size: m.Histogram(metrics.ProfileSize)}
+	c.Upstream = newLabelGuardUpstream(c.Upstream, c.LabelLimits, logger)
+
+	// The defaults of the godeltaprof profilers.
+	deltaOptions := godeltaprof.ProfileOptions{
+		GenericsFrames:       true,
+		LazyMappings:         true,
+		GoroutineStateLabels: c.GoroutineStateLabels,
+		Compression:          c.ProfileCompression,
+	}
+
 	ps := &Session{
 		upstream:         c.Upstream,
 		appNames:         appNames,
 		profileTypes:     c.ProfilingTypes,
 		disableGCRuns:    c.DisableGCRuns,
+		heapGC:           c.HeapGC,
 		uploadRate:       c.UploadRate,
 		stopCh:           make(chan struct{}),
 		flushCh:          make(chan *flush),
-		logger:           c.Logger,
+		reconfigCh:       make(chan *reconfig),
+		appName:          c.AppName,
+		sessionID:        sid,
+		logger:           logger,
 		memBuf:           &bytes.Buffer{},
 		goroutinesBuf:    &bytes.Buffer{},
 		goroutineLeakBuf: &bytes.Buffer{},
 		mutexBuf:         &bytes.Buffer{},
 		blockBuf:         &bytes.Buffer{},
-
-		deltaBlock: godeltaprof.NewBlockProfiler(),
-		deltaMutex: godeltaprof.NewMutexProfiler(),
-		deltaHeap:  godeltaprof.NewHeapProfiler(),
-		cpu:        newCPUProfileCollector(appNames.SDK, c.Upstream, c.Logger, c.UploadRate),
+		wallBuf:          &bytes.Buffer{},
+		threadsBuf:       &bytes.Buffer{},
+		metricsBuf:       &bytes.Buffer{},
+
+		deltaBlock:      godeltaprof.NewBlockProfilerWithOptions(deltaOptions),
+		deltaMutex:      godeltaprof.NewMutexProfilerWithOptions(deltaOptions),
+		deltaHeap:       godeltaprof.NewHeapProfilerWithOptions(deltaOptions),
+		goroutines:      godeltaprof.NewGoroutineProfilerWithOptions(deltaOptions),
+		wall:            internal.NewWallProfiler(wallSampleInterval),
+		splitCPUBy:      c.SplitCPUProfileBy,
+		sampleRate:      c.SampleRate,
+		cpuCollector:    newCPUCollector(c.CPUProfiler, c.SampleRate, logger),
+		collectDuration: m.Histogram(metrics.CollectDuration),
+		forcedGC:        m.Counter(metrics.ForcedGC),
+		runtimeMetrics:  internal.NewRuntimeMetricsProfiler(),
+		runtimeConf: RuntimeConfig{
+			ProfileTypes:  slices.Clone(c.ProfilingTypes),
+			UploadRate:    c.UploadRate,
+			Tags:          maps.Clone(c.Tags),
+			DisableGCRuns: c.DisableGCRuns,
+		},
 	}
+	ps.cpu = ps.newCPUProfileCollector()
 
 	return ps, nil
 }
@@ -142,20 +262,52 @@ func (ps *Session) takeSnapshots() {
 
 		case f := <-ps.flushCh:
 			ps.reset(ps.startTime, ps.truncatedTime())
-			_ = ps.cpu.Flush()
+			// The CPU collector only handles events while it is running:
+			// Flush would block forever if ProfileTypes has no CPU profile,
+			// or if the CPU profile was disabled with Reconfigure.
+			if ps.isCPUEnabled() {
+				_ = ps.cpu.Flush()
+			}
 			ps.upstream.Flush()
 			f.wg.Done()
 
+		case r := <-ps.reconfigCh:
+			ps.applyConfig(r)
+			t.Reset(ps.uploadRate)
+			close(r.done)
+
 		case <-ps.stopCh:
 			if ps.isCPUEnabled() {
 				ps.cpu.Stop()
 			}
+			ps.wall.Stop()
 
 			return
 		}
 	}
 }
 
+func (ps *Session) newCPUProfileCollector() *cpuProfileCollector {
+	c := newCPUProfileCollector(ps.appNames.SDK, ps.appNames.SDKLabels, ps.upstream, ps.logger, ps.uploadRate)
+	c.splitBy = ps.splitCPUBy
+	c.sampleRate = ps.sampleRate
+	c.collector = ps.cpuCollector
+
+	return c
+}
+
+// meteredUpstream reports the size of the uploaded profiles.
+type meteredUpstream struct {
+	upstream.Upstream
+
+	size metrics.Histogram
+}
+
+func (u *meteredUpstream) Upload(j *upstream.UploadJob) {
+	u.size.Observe(float64(len(j.Profile)), j.ProfileName)
+	u.Upstream.Upload(j)
+}
+
 func copyBuf(b []byte) []byte {
 	r := make([]byte, len(b))
 	copy(r, b)
@@ -174,16 +326,127 @@ func (ps *Session) Start() error {
 	}()
 
 	if ps.isCPUEnabled() {
-		ps.wg.Add(1)
-		go func() {
-			defer ps.wg.Done()
-			ps.cpu.Start()
-		}()
+		ps.startCPU()
+	}
+	if ps.isWallEnabled() {
+		ps.wall.Start()
 	}
 
 	return nil
 }
 
+func (ps *Session) startCPU() {
+	cpu := ps.cpu
+	ps.wg.Add(1)
+	go func() {
+		defer ps.wg.Done()
+		cpu.Start()
+	}()
+}
+
+// Reconfigure changes the configuration of the running session. Profiles
+// collected so far are uploaded with the previous configuration, then the
+// new upload interval starts.
+func (ps *Session) Reconfigure(c RuntimeConfig) error {
+	if c.UploadRate == 0 {
+		c.UploadRate = 15 * time.Second
+	}
+	appNames, err := semconv.MergeTagsWithAppName(ps.appName, ps.sessionID.String(), c.Tags)
+	if err != nil {
+		return err
+	}
+	ps.logger.Info("reconfiguring profiling session",
+		"app_name", ps.appName,
+		"tags", c.Tags,
+		"profile_types", c.ProfileTypes,
+		"disable_gc_runs", c.DisableGCRuns,
+		"upload_rate", c.UploadRate)
+	prev := ps.RuntimeConfig().ProfileTypes
+	warnZeroRates(ps.logger, slices.DeleteFunc(slices.Clone(c.ProfileTypes), func(t ProfileType) bool {
+		return slices.Contains(prev, t)
+	}))
+
+	r := &reconfig{
+		RuntimeConfig: c,
+		appNames:      appNames,
+		done:          make(chan struct{}),
+	}
+	select {
+	case ps.reconfigCh <- r:
+	case <-ps.stopCh:
+		return errSessionStopped
+	}
+	<-r.done
+	c.Tags = maps.Clone(c.Tags)
+	c.ProfileTypes = slices.Clone(c.ProfileTypes)
+	ps.runtimeMu.Lock()
+	ps.runtimeConf = c
+	ps.runtimeMu.Unlock()
+
+	return nil
+}
+
+// RuntimeConfig returns the current configuration of the session.
+func (ps *Session) RuntimeConfig() RuntimeConfig {
+	ps.runtimeMu.Lock()
+	defer ps.runtimeMu.Unlock()
+	c := ps.runtimeConf
+	c.Tags = maps.Clone(c.Tags)
+	c.ProfileTypes = slices.Clone(c.ProfileTypes)
+
+	return c
+}
+
+func (ps *Session) applyConfig(r *reconfig) {
+	ps.reset(ps.startTime, time.Now())
+
+	wasCPU := ps.isCPUEnabled()
+	wasMem := ps.isMemEnabled()
+	wasMutex := ps.isMutexEnabled()
+	wasBlock := ps.isBlockEnabled()
+	wasWall := ps.isWallEnabled()
+	wasRuntimeMetrics := ps.isRuntimeMetricsEnabled()
+
+	ps.profileTypes = r.ProfileTypes
+	ps.uploadRate = r.UploadRate
+	ps.disableGCRuns = r.DisableGCRuns
+	ps.appNames = r.appNames
+
+	// Delta profilers of newly enabled profile types must not
+	// report everything that happened before they were enabled.
+	if !wasMem && ps.isMemEnabled() {
+		_ = ps.deltaHeap.Profile(io.Discard)
+		ps.lastGCGeneration = numGC()
+		ps.windowsWithoutGC = 0
+	}
+	if !wasMutex && ps.isMutexEnabled() {
+		_ = ps.deltaMutex.Profile(io.Discard)
+	}
+	if !wasBlock && ps.isBlockEnabled() {
+		_ = ps.deltaBlock.Profile(io.Discard)
+	}
+	if !wasRuntimeMetrics && ps.isRuntimeMetricsEnabled() {
+		_ = ps.runtimeMetrics.Profile(io.Discard)
+	}
+
+	switch isWall := ps.isWallEnabled(); {
+	case wasWall && !isWall:
+		ps.wall.Stop()
+	case !wasWall && isWall:
+		ps.wall.Start()
+	}
+
+	switch isCPU := ps.isCPUEnabled(); {
+	case wasCPU && isCPU:
+		_ = ps.cpu.Reconfigure(ps.appNames.SDK, ps.appNames.SDKLabels, ps.uploadRate)
+	case wasCPU:
+		ps.cpu.Stop()
+	case isCPU:
+		ps.cpu = ps.newCPUProfileCollector()
+		ps.startCPU()
+	}
+}
+
 func (ps *Session) isCPUEnabled() bool {
 	for _, t := range ps.profileTypes {
 		if t == ProfileCPU {
@@ -244,8 +507,38 @@ func (ps *Session) isGoroutineLeakEnabled() bool {
 	return false
 }
 
+func (ps *Session) isWallEnabled() bool {
+	for _, t := range ps.profileTypes {
+		if t == ProfileWall {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ps *Session) isThreadCreateEnabled() bool {
+	for _, t := range ps.profileTypes {
+		if t == ProfileThreadCreate {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ps *Session) isRuntimeMetricsEnabled() bool {
+	for _, t := range ps.profileTypes {
+		if t == ProfileRuntimeMetrics {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (ps *Session) reset(startTime, endTime time.Time) {
-	ps.logger.Debugf("profiling session reset %s", startTime.String())
+	ps.logger.Debug("profiling session reset", "start_time", startTime)
 	// first reset should not result in an upload
 	if !ps.startTime.IsZero() {
 		ps.uploadData(startTime, endTime)
@@ -255,46 +548,51 @@ func (ps *Session) reset(startTime, endTime time.Time) {
 
 func (ps *Session) uploadData(startTime, endTime time.Time) {
 	if ps.isGoroutinesEnabled() {
-		p := pprof.Lookup("goroutine")
-		if p != nil {
-			err := p.WriteTo(ps.goroutinesBuf, 0)
-			if err != nil {
-				ps.logger.Errorf("failed to dump goroutines profile: %s", err)
+		start := time.Now()
+		err := ps.goroutines.Profile(ps.goroutinesBuf)
+		ps.observeCollect(upstream.ProfileNameGoroutine, start)
+		if err != nil {
+			ps.logger.Error("failed to dump profile", "profile_type", upstream.ProfileNameGoroutine, "err", err)
 
-				return
-			}
-			ps.upstream.Upload(&upstream.UploadJob{
-				Name:            ps.appNames.SDK,
-				StartTime:       startTime,
-				EndTime:         endTime,
-				SpyName:         "gospy",
-				Units:           "goroutines",
-				AggregationType: "average",
-				Format:          upstream.FormatPprof,
-				Profile:         copyBuf(ps.goroutinesBuf.Bytes()),
-				SampleTypeConfig: map[string]*upstream.SampleType{
-					"goroutine": {
-						DisplayName: "goroutines",
-						Units:       "goroutines",
-						Aggregation: "average",
-					},
-				},
-			})
-			ps.goroutinesBuf.Reset()
+			return
 		}
+		ps.upstream.Upload(&upstream.UploadJob{
+			Name:            ps.appNames.SDK,
+			ProfileName:     upstream.ProfileNameGoroutine,
+			Labels:          ps.appNames.SDKLabels,
+			StartTime:       startTime,
+			EndTime:         endTime,
+			SpyName:         "gospy",
+			Units:           "goroutines",
+			AggregationType: "average",
+			Format:          upstream.FormatPprof,
+			Profile:         copyBuf(ps.goroutinesBuf.Bytes()),
+			SampleTypeConfig: map[string]*upstream.SampleType{
+				"goroutine": {
+					DisplayName: "goroutines",
+					Units:       "goroutines",
+					Aggregation: "average",
+				},
+			},
+		})
+		ps.goroutinesBuf.Reset()
 	}
 
 	if ps.isGoroutineLeakEnabled() {
 		p := pprof.Lookup("goroutineleak")
 		if p != nil {
+			start := time.Now()
 			err := p.WriteTo(ps.goroutineLeakBuf, 0)
+			ps.observeCollect(upstream.ProfileNameGoroutineLeak, start)
 			if err != nil {
-				ps.logger.Errorf("failed to dump goroutine leak profile: %s", err)
+				ps.logger.Error("failed to dump profile", "profile_type", upstream.ProfileNameGoroutineLeak, "err", err)
 
 				return
 			}
 			ps.upstream.Upload(&upstream.UploadJob{
 				Name:             ps.appNames.SDK,
+				ProfileName:      upstream.ProfileNameGoroutineLeak,
+				Labels:           ps.appNames.SDKLabels,
 				StartTime:        startTime,
 				EndTime:          endTime,
 				SpyName:          "gospy",
@@ -308,6 +606,15 @@ func (ps *Session) uploadData(startTime, endTime time.Time) {
 		}
 	}
 
+	if ps.isWallEnabled() {
+		ps.dumpWallProfile(startTime, endTime)
+	}
+	if ps.isThreadCreateEnabled() {
+		ps.dumpThreadCreateProfile(startTime, endTime)
+	}
+	if ps.isRuntimeMetricsEnabled() {
+		ps.dumpRuntimeMetricsProfile(startTime, endTime)
+	}
 	if ps.isBlockEnabled() {
 		ps.dumpBlockProfile(startTime, endTime)
 	}
@@ -322,57 +629,77 @@ func (ps *Session) uploadData(startTime, endTime time.Time) {
 func (ps *Session) dumpHeapProfile(startTime time.Time, endTime time.Time) {
 	defer func() {
 		if r := recover(); r != nil {
-			ps.logger.Errorf("dump heap profiler panic %s", string(debug.Stack()))
+			ps.logger.Error("profiler panic",
+				"profile_type", upstream.ProfileNameMemory, "panic", r, "stack", string(debug.Stack()))
 		}
 	}()
 	currentGCGeneration := numGC()
 	// sometimes GC doesn't run within 10 seconds
-	//   in such cases we force a GC run
+	//   in such cases we force a GC run, if the heap GC policy allows it
 	//   users can disable it with disableGCRuns option
-	if currentGCGeneration == ps.lastGCGeneration && !ps.disableGCRuns {
-		runtime.GC()
-		currentGCGeneration = numGC()
+	if currentGCGeneration == ps.lastGCGeneration {
+		ps.windowsWithoutGC++
+		if !ps.disableGCRuns && ps.heapGC.allowsGC(ps.windowsWithoutGC) {
+			runtime.GC()
+			ps.forcedGC.Add(1)
+			currentGCGeneration = numGC()
+		}
 	}
-	if currentGCGeneration != ps.lastGCGeneration {
-		ps.memBuf.Reset()
-		err := ps.deltaHeap.Profile(ps.memBuf)
-		if err != nil {
-			ps.logger.Errorf("failed to dump heap profile: %s", err)
+	ps.memBuf.Reset()
+	start := time.Now()
+	err := ps.deltaHeap.Profile(ps.memBuf)
+	ps.observeCollect(upstream.ProfileNameMemory, start)
+	if err != nil {
+		ps.logger.Error("failed to dump profile", "profile_type", upstream.ProfileNameMemory, "err", err)
 
-			return
-		}
-		curMemBytes := copyBuf(ps.memBuf.Bytes())
-		job := &upstream.UploadJob{
-			Name:             ps.appNames.Godeltaprof,
-			StartTime:        startTime,
-			EndTime:          endTime,
-			SpyName:          "gospy",
-			SampleRate:       100,
-			Format:           upstream.FormatPprof,
-			Profile:          curMemBytes,
-			SampleTypeConfig: sampleTypeConfigHeap,
-		}
-		ps.upstream.Upload(job)
-		ps.lastGCGeneration = currentGCGeneration
+		return
 	}
+	curMemBytes := copyBuf(ps.memBuf.Bytes())
+	job := &upstream.UploadJob{
+		Name:             ps.appNames.Godeltaprof,
+		ProfileName:      upstream.ProfileNameMemory,
+		Labels:           ps.appNames.GodeltaprofLabels,
+		StartTime:        startTime,
+		EndTime:          endTime,
+		SpyName:          "gospy",
+		SampleRate:       100,
+		Format:           upstream.FormatPprof,
+		Profile:          curMemBytes,
+		SampleTypeConfig: sampleTypeConfigHeap,
+	}
+	if currentGCGeneration == ps.lastGCGeneration {
+		// The profile has not changed since the last GC cycle.
+		ls := labelset.New(maps.Clone(ps.appNames.GodeltaprofLabels))
+		ls.Add(labelStaleHeap, "true")
+		job.Name, job.Labels = ls.Normalized(), ls.Labels()
+	} else {
+		ps.windowsWithoutGC = 0
+	}
+	ps.upstream.Upload(job)
+	ps.lastGCGeneration = currentGCGeneration
 }
 
 func (ps *Session) dumpMutexProfile(startTime time.Time, endTime time.Time) {
 	defer func() {
 		if r := recover(); r != nil {
-			ps.logger.Errorf("dump mutex profiler panic %s", string(debug.Stack()))
+			ps.logger.Error("profiler panic",
+				"profile_type", upstream.ProfileNameMutex, "panic", r, "stack", string(debug.Stack()))
 		}
 	}()
 	ps.mutexBuf.Reset()
+	start := time.Now()
 	err := ps.deltaMutex.Profile(ps.mutexBuf)
+	ps.observeCollect(upstream.ProfileNameMutex, start)
 	if err != nil {
-		ps.logger.Errorf("failed to dump mutex profile: %s", err)
+		ps.logger.Error("failed to dump profile", "profile_type", upstream.ProfileNameMutex, "err", err)
 
 		return
 	}
 	curMutexBuf := copyBuf(ps.mutexBuf.Bytes())
 	job := &upstream.UploadJob{
 		Name:             ps.appNames.Godeltaprof,
+		ProfileName:      upstream.ProfileNameMutex,
+		Labels:           ps.appNames.GodeltaprofLabels,
 		StartTime:        startTime,
 		EndTime:          endTime,
 		SpyName:          "gospy",
@@ -386,19 +713,24 @@ func (ps *Session) dumpMutexProfile(startTime time.Time, endTime time.Time) {
 func (ps *Session) dumpBlockProfile(startTime time.Time, endTime time.Time) {
 	defer func() {
 		if r := recover(); r != nil {
-			ps.logger.Errorf("dump block profiler panic %s", string(debug.Stack()))
+			ps.logger.Error("profiler panic",
+				"profile_type", upstream.ProfileNameBlock, "panic", r, "stack", string(debug.Stack()))
 		}
 	}()
 	ps.blockBuf.Reset()
+	start := time.Now()
 	err := ps.deltaBlock.Profile(ps.blockBuf)
+	ps.observeCollect(upstream.ProfileNameBlock, start)
 	if err != nil {
-		ps.logger.Errorf("failed to dump block profile: %s", err)
+		ps.logger.Error("failed to dump profile", "profile_type", upstream.ProfileNameBlock, "err", err)
 
 		return
 	}
 	curBlockBuf := copyBuf(ps.blockBuf.Bytes())
 	job := &upstream.UploadJob{
 		Name:             ps.appNames.Godeltaprof,
+		ProfileName:      upstream.ProfileNameBlock,
+		Labels:           ps.appNames.GodeltaprofLabels,
 		StartTime:        startTime,
 		EndTime:          endTime,
 		SpyName:          "gospy",
@@ -409,6 +741,85 @@ func (ps *Session) dumpBlockProfile(startTime time.Time, endTime time.Time) {
 	ps.upstream.Upload(job)
 }
 
+func (ps *Session) dumpWallProfile(startTime time.Time, endTime time.Time) {
+	ps.wallBuf.Reset()
+	start := time.Now()
+	err := ps.wall.Profile(ps.wallBuf)
+	ps.observeCollect(upstream.ProfileNameWall, start)
+	if err != nil {
+		ps.logger.Error("failed to dump profile", "profile_type", upstream.ProfileNameWall, "err", err)
+
+		return
+	}
+	ps.upstream.Upload(&upstream.UploadJob{
+		Name:            ps.appNames.SDK,
+		ProfileName:     upstream.ProfileNameWall,
+		Labels:          ps.appNames.SDKLabels,
+		StartTime:       startTime,
+		EndTime:         endTime,
+		SpyName:         "gospy",
+		SampleRate:      uint32(time.Second / wallSampleInterval),
+		Units:           "samples",
+		AggregationType: "sum",
+		Format:          upstream.FormatPprof,
+		Profile:         copyBuf(ps.wallBuf.Bytes()),
+	})
+}
+
+func (ps *Session) dumpThreadCreateProfile(startTime time.Time, endTime time.Time) {
+	ps.threadsBuf.Reset()
+	start := time.Now()
+	err := pprof.Lookup("threadcreate").WriteTo(ps.threadsBuf, 0)
+	ps.observeCollect(upstream.ProfileNameThreadCreate, start)
+	if err != nil {
+		ps.logger.Error("failed to dump profile", "profile_type", upstream.ProfileNameThreadCreate, "err", err)
+
+		return
+	}
+	ps.upstream.Upload(&upstream.UploadJob{
+		Name:             ps.appNames.SDK,
+		ProfileName:      upstream.ProfileNameThreadCreate,
+		Labels:           ps.appNames.SDKLabels,
+		StartTime:        startTime,
+		EndTime:          endTime,
+		SpyName:          "gospy",
+		Units:            "threads",
+		AggregationType:  "average",
+		Format:           upstream.FormatPprof,
+		Profile:          copyBuf(ps.threadsBuf.Bytes()),
+		SampleTypeConfig: sampleTypeConfigThreadCreate,
+	})
+}
+
+func (ps *Session) dumpRuntimeMetricsProfile(startTime time.Time, endTime time.Time) {
+	ps.metricsBuf.Reset()
+	start := time.Now()
+	err := ps.runtimeMetrics.Profile(ps.metricsBuf)
+	ps.observeCollect(upstream.ProfileNameRuntimeMetrics, start)
+	if err != nil {
+		ps.logger.Error("failed to dump profile", "profile_type", upstream.ProfileNameRuntimeMetrics, "err", err)
+
+		return
+	}
+	ps.upstream.Upload(&upstream.UploadJob{
+		Name:             ps.appNames.SDK,
+		ProfileName:      upstream.ProfileNameRuntimeMetrics,
+		Labels:           ps.appNames.SDKLabels,
+		StartTime:        startTime,
+		EndTime:          endTime,
+		SpyName:          "gospy",
+		Units:            "nanoseconds",
+		AggregationType:  "sum",
+		Format:           upstream.FormatPprof,
+		Profile:          copyBuf(ps.metricsBuf.Bytes()),
+		SampleTypeConfig: sampleTypeConfigRuntimeMetrics,
+	})
+}
+
+func (ps *Session) observeCollect(profileName string, start time.Time) {
+	ps.collectDuration.Observe(time.Since(start).Seconds(), profileName)
+}
+
 func (ps *Session) Stop() {
 	ps.stopOnce.Do(func() {
 		close(ps.stopCh)
@@ -432,6 +843,11 @@ func (ps *Session) truncatedTime() time.Time {
 	return time.Now().Truncate(ps.uploadRate)
 }
 
+var (
+	errSessionStopped      = errors.New("profiling session is stopped")
+	errPerfSplitCPUProfile = errors.New("the perf_event CPU profilers do not record labels to split the profile by")
+)
+
 func numGC() uint32 {
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
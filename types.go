@@ -4,7 +4,10 @@ type ProfileType string
 
 // Logger is an interface that library users can use
 // It is based on logrus, but much smaller — That's because we don't want library users to have to implement
-// all of the logrus's methods
+// all of the logrus's methods.
+//
+// Loggers that also implement a Slog() *slog.Logger method, such as the
+// one returned by NewSlogLogger, receive structured log records instead.
 type Logger interface {
 	Infof(_ string, _ ...interface{})
 	Debugf(_ string, _ ...interface{})
@@ -12,20 +15,41 @@ type Logger interface {
 }
 
 const (
-	ProfileCPU           ProfileType = "cpu"
-	ProfileInuseObjects  ProfileType = "inuse_objects"
-	ProfileAllocObjects  ProfileType = "alloc_objects"
-	ProfileInuseSpace    ProfileType = "inuse_space"
-	ProfileAllocSpace    ProfileType = "alloc_space"
-	ProfileGoroutines    ProfileType = "goroutines"
-	ProfileMutexCount    ProfileType = "mutex_count"
-	ProfileMutexDuration ProfileType = "mutex_duration"
-	ProfileBlockCount    ProfileType = "block_count"
-	ProfileBlockDuration ProfileType = "block_duration"
-	ProfileGoroutineLeak ProfileType = "goroutine_leak"
-	DefaultSampleRate                = 100
+	ProfileCPU            ProfileType = "cpu"
+	ProfileInuseObjects   ProfileType = "inuse_objects"
+	ProfileAllocObjects   ProfileType = "alloc_objects"
+	ProfileInuseSpace     ProfileType = "inuse_space"
+	ProfileAllocSpace     ProfileType = "alloc_space"
+	ProfileGoroutines     ProfileType = "goroutines"
+	ProfileMutexCount     ProfileType = "mutex_count"
+	ProfileMutexDuration  ProfileType = "mutex_duration"
+	ProfileBlockCount     ProfileType = "block_count"
+	ProfileBlockDuration  ProfileType = "block_duration"
+	ProfileGoroutineLeak  ProfileType = "goroutine_leak"
+	ProfileWall           ProfileType = "wall" // stacks of all goroutines, running or waiting
+	ProfileThreadCreate   ProfileType = "threadcreate"
+	ProfileRuntimeMetrics ProfileType = "runtime_metrics" // GC pauses, scheduling latencies and mutex wait time
+	DefaultSampleRate                 = 100
 )
 
+// profileTypes lists all the supported profile types.
+var profileTypes = []ProfileType{ //nolint:gochecknoglobals
+	ProfileCPU,
+	ProfileInuseObjects,
+	ProfileAllocObjects,
+	ProfileInuseSpace,
+	ProfileAllocSpace,
+	ProfileGoroutines,
+	ProfileMutexCount,
+	ProfileMutexDuration,
+	ProfileBlockCount,
+	ProfileBlockDuration,
+	ProfileGoroutineLeak,
+	ProfileWall,
+	ProfileThreadCreate,
+	ProfileRuntimeMetrics,
+}
+
 var DefaultProfileTypes = []ProfileType{ //nolint:gochecknoglobals
 	ProfileCPU,
 	ProfileAllocObjects,
@@ -0,0 +1,63 @@
+// Package fanout implements an upstream that sends every profile
+// to multiple upstreams.
+package fanout
+
+import (
+	"sync"
+
+	"github.com/grafana/pyroscope-go/upstream"
+)
+
+// Fanout sends every profile to all the upstreams it is created with.
+//
+// Upstreams are independent from each other: each one is expected to have
+// its own queue and not to block in Upload, as remote.Remote and
+// push.Pusher do. Upload jobs are shared between the upstreams and must
+// not be modified.
+type Fanout struct {
+	upstreams []upstream.Upstream
+}
+
+func NewFanout(upstreams ...upstream.Upstream) *Fanout {
+	return &Fanout{upstreams: upstreams}
+}
+
+// Start starts the upstreams that implement upstream.Lifecycle.
+func (f *Fanout) Start() {
+	for _, u := range f.upstreams {
+		if l, ok := u.(upstream.Lifecycle); ok {
+			l.Start()
+		}
+	}
+}
+
+// Stop stops the upstreams that implement upstream.Lifecycle,
+// and waits for all of them.
+func (f *Fanout) Stop() {
+	f.each(func(u upstream.Upstream) {
+		if l, ok := u.(upstream.Lifecycle); ok {
+			l.Stop()
+		}
+	})
+}
+
+func (f *Fanout) Upload(j *upstream.UploadJob) {
+	for _, u := range f.upstreams {
+		u.Upload(j)
+	}
+}
+
+// Flush waits for all the upstreams to be flushed.
+func (f *Fanout) Flush() {
+	f.each(upstream.Upstream.Flush)
+}
+
+// each calls fn for every upstream concurrently, so that
+// a slow upstream does not delay the others.
+func (f *Fanout) each(fn func(upstream.Upstream)) {
+	var wg sync.WaitGroup
+	for _, u := range f.upstreams {
+		wg.Go(func() { fn(u) })
+	}
+	wg.Wait()
+}
@@ -0,0 +1,68 @@
+package fanout
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/pyroscope-go/upstream"
+)
+
+type mockUpstream struct {
+	sync.Mutex
+
+	uploaded []*upstream.UploadJob
+	delay    time.Duration
+	flushed  int
+	started  bool
+	stopped  bool
+}
+
+func (m *mockUpstream) Upload(j *upstream.UploadJob) {
+	m.Lock()
+	m.uploaded = append(m.uploaded, j)
+	m.Unlock()
+}
+
+func (m *mockUpstream) Flush() {
+	time.Sleep(m.delay)
+	m.Lock()
+	m.flushed++
+	m.Unlock()
+}
+
+func (m *mockUpstream) Start() { m.started = true }
+func (m *mockUpstream) Stop()  { m.stopped = true }
+
+func TestFanout(t *testing.T) {
+	a := &mockUpstream{delay: 100 * time.Millisecond}
+	b := &mockUpstream{delay: 100 * time.Millisecond}
+	c := new(mockUpstream)
+	// Hides Start and Stop methods.
+	f := NewFanout(a, b, struct{ upstream.Upstream }{c})
+
+	f.Start()
+	assert.True(t, a.started)
+	assert.True(t, b.started)
+	assert.False(t, c.started)
+
+	j := &upstream.UploadJob{Name: "test"}
+	f.Upload(j)
+	for _, m := range []*mockUpstream{a, b, c} {
+		assert.Equal(t, []*upstream.UploadJob{j}, m.uploaded)
+	}
+
+	start := time.Now()
+	f.Flush()
+	assert.Less(t, time.Since(start), 200*time.Millisecond, "upstreams must be flushed concurrently")
+	assert.Equal(t, 1, a.flushed)
+	assert.Equal(t, 1, b.flushed)
+	assert.Equal(t, 1, c.flushed)
+
+	f.Stop()
+	assert.True(t, a.stopped)
+	assert.True(t, b.stopped)
+	assert.False(t, c.stopped)
+}
@@ -0,0 +1,284 @@
+// Package file implements an upstream that writes profiles to a local
+// directory instead of sending them to a server.
+//
+// Every profile is written to a pprof file named after the application,
+// the profile type and the profile time window, for example:
+//
+//	my-app_process_cpu_20240102T150405Z_20240102T150420Z.pprof
+//
+// A JSON sidecar file with the same name and the .json extension holds
+// the profile Metadata required to upload the profile later.
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/pyroscope-go/internal/labelset"
+	"github.com/grafana/pyroscope-go/internal/logging"
+	"github.com/grafana/pyroscope-go/upstream"
+)
+
+const (
+	profileExt  = ".pprof"
+	metadataExt = ".json"
+	timeFormat  = "20060102T150405Z"
+)
+
+var errDirRequired = errors.New("profiles directory is required")
+
+// Metadata describes a profile written to disk; it is stored
+// in the JSON sidecar file next to the profile.
+type Metadata struct {
+	Name             string                          `json:"name"`
+	ProfileName      string                          `json:"profileName,omitempty"`
+	Labels           map[string]string               `json:"labels,omitempty"`
+	StartTime        time.Time                       `json:"startTime"`
+	EndTime          time.Time                       `json:"endTime"`
+	SpyName          string                          `json:"spyName,omitempty"`
+	SampleRate       uint32                          `json:"sampleRate,omitempty"`
+	Units            string                          `json:"units,omitempty"`
+	AggregationType  string                          `json:"aggregationType,omitempty"`
+	Format           upstream.Format                 `json:"format,omitempty"`
+	SampleTypeConfig map[string]*upstream.SampleType `json:"sampleTypeConfig,omitempty"`
+}
+
+type Config struct {
+	// Dir is the directory profiles are written to.
+	Dir string
+	// RotationInterval, if set, makes profiles grouped into subdirectories,
+	// one per interval, named after the interval start time.
+	RotationInterval time.Duration
+	// MaxSize limits the total size of the written files in bytes; the
+	// oldest profiles are removed when the limit is exceeded. Zero means
+	// no limit.
+	MaxSize int64
+	// MaxAge is the age after which profiles are removed. Zero means
+	// profiles are kept forever.
+	MaxAge time.Duration
+	Logger Logger
+}
+
+type Logger interface {
+	Infof(_ string, _ ...interface{})
+	Debugf(_ string, _ ...interface{})
+	Errorf(_ string, _ ...interface{})
+}
+
+// File is an upstream that writes profiles to the local file system.
+// Profiles are written synchronously in Upload, therefore Flush is no-op.
+type File struct {
+	mu     sync.Mutex
+	cfg    Config
+	logger *logging.Logger
+	now    func() time.Time
+
+	// files written, sorted by the profile end time.
+	files []profileFile
+	size  int64
+}
+
+type profileFile struct {
+	path    string // without extension
+	endTime time.Time
+	size    int64
+}
+
+func NewFile(cfg Config) (*File, error) {
+	if cfg.Dir == "" {
+		return nil, errDirRequired
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create profiles directory: %w", err)
+	}
+	f := &File{
+		cfg:    cfg,
+		logger: logging.New(cfg.Logger),
+		now:    time.Now,
+	}
+	if err := f.loadFiles(); err != nil {
+		return nil, fmt.Errorf("read profiles directory: %w", err)
+	}
+
+	return f, nil
+}
+
+func (f *File) Upload(j *upstream.UploadJob) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.write(j); err != nil {
+		f.logger.Error("failed to write profile", "err", err)
+
+		return
+	}
+	f.enforceRetention()
+}
+
+func (*File) Flush() {}
+
+func (f *File) write(j *upstream.UploadJob) error {
+	dir := f.cfg.Dir
+	if f.cfg.RotationInterval > 0 {
+		dir = filepath.Join(dir, j.EndTime.Truncate(f.cfg.RotationInterval).UTC().Format(timeFormat))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	base := fileName(j)
+	p := filepath.Join(dir, base)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(p + profileExt); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		p = filepath.Join(dir, base+"-"+strconv.Itoa(i))
+	}
+
+	md, err := json.Marshal(Metadata{
+		Name:             j.Name,
+		ProfileName:      j.ProfileName,
+		Labels:           j.Labels,
+		StartTime:        j.StartTime,
+		EndTime:          j.EndTime,
+		SpyName:          j.SpyName,
+		SampleRate:       j.SampleRate,
+		Units:            j.Units,
+		AggregationType:  j.AggregationType,
+		Format:           j.Format,
+		SampleTypeConfig: j.SampleTypeConfig,
+	})
+	if err != nil {
+		return err
+	}
+	// The sidecar is written first: a profile file
+	// without metadata is never observed.
+	if err = os.WriteFile(p+metadataExt, md, 0o644); err != nil { //nolint:gosec
+		return err
+	}
+	if err = os.WriteFile(p+profileExt, j.Profile, 0o644); err != nil { //nolint:gosec
+		_ = os.Remove(p + metadataExt)
+
+		return err
+	}
+	f.logger.Debug("profile written", "path", p+profileExt)
+	f.add(profileFile{
+		path:    p,
+		endTime: j.EndTime,
+		size:    int64(len(md) + len(j.Profile)),
+	})
+
+	return nil
+}
+
+func (f *File) add(pf profileFile) {
+	i, _ := slices.BinarySearchFunc(f.files, pf, compareFiles)
+	f.files = slices.Insert(f.files, i, pf)
+	f.size += pf.size
+}
+
+func (f *File) enforceRetention() {
+	var n int
+	for _, pf := range f.files {
+		expired := f.cfg.MaxAge > 0 && f.now().Sub(pf.endTime) > f.cfg.MaxAge
+		exceeds := f.cfg.MaxSize > 0 && f.size > f.cfg.MaxSize
+		if !expired && !exceeds {
+			break
+		}
+		f.remove(pf)
+		n++
+	}
+	f.files = f.files[n:]
+}
+
+func (f *File) remove(pf profileFile) {
+	f.logger.Debug("removing profile", "path", pf.path+profileExt)
+	_ = os.Remove(pf.path + profileExt)
+	_ = os.Remove(pf.path + metadataExt)
+	f.size -= pf.size
+	if dir := filepath.Dir(pf.path); dir != filepath.Clean(f.cfg.Dir) {
+		// Removes the rotated directory, if empty.
+		_ = os.Remove(dir)
+	}
+}
+
+// loadFiles indexes profiles written previously, so that
+// they are subject to the retention policy.
+func (f *File) loadFiles() error {
+	return filepath.WalkDir(f.cfg.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(p, metadataExt) {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var md Metadata
+		if err = json.Unmarshal(b, &md); err != nil {
+			f.logger.Error("ignoring invalid profile metadata", "path", p, "err", err)
+
+			return nil //nolint:nilerr
+		}
+		pf := profileFile{
+			path:    strings.TrimSuffix(p, metadataExt),
+			endTime: md.EndTime,
+			size:    int64(len(b)),
+		}
+		if info, err := os.Stat(pf.path + profileExt); err == nil {
+			pf.size += info.Size()
+		}
+		f.add(pf)
+
+		return nil
+	})
+}
+
+func compareFiles(a, b profileFile) int {
+	if c := a.endTime.Compare(b.endTime); c != 0 {
+		return c
+	}
+
+	return strings.Compare(a.path, b.path)
+}
+
+// fileName returns the file name of the profile, without extension.
+func fileName(j *upstream.UploadJob) string {
+	app := j.Labels[labelset.ReservedLabelNameName]
+	if app == "" {
+		if ls, err := labelset.Parse(j.Name); err == nil {
+			app = ls.ServiceName()
+		}
+	}
+	profileName := j.ProfileName
+	if profileName == "" {
+		profileName = "profile"
+	}
+
+	return strings.Join([]string{
+		sanitize(app),
+		sanitize(profileName),
+		j.StartTime.UTC().Format(timeFormat),
+		j.EndTime.UTC().Format(timeFormat),
+	}, "_")
+}
+
+func sanitize(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+
+	return strings.Map(func(r rune) rune {
+		if labelset.IsServiceNameRuneAllowed(r) && r != '/' {
+			return r
+		}
+
+		return '_'
+	}, s)
+}
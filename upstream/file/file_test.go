@@ -0,0 +1,105 @@
+package file
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/pyroscope-go/internal/testutil"
+	"github.com/grafana/pyroscope-go/upstream"
+)
+
+var testStart = time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC) //nolint:gochecknoglobals
+
+func testJob(profileName string, start time.Time) *upstream.UploadJob {
+	return &upstream.UploadJob{
+		Name:        "my-app{foo=bar}",
+		ProfileName: profileName,
+		Labels:      map[string]string{"__name__": "my-app", "foo": "bar"},
+		StartTime:   start,
+		EndTime:     start.Add(15 * time.Second),
+		SpyName:     "gospy",
+		Format:      upstream.FormatPprof,
+		Profile:     []byte(profileName),
+		SampleTypeConfig: map[string]*upstream.SampleType{
+			"alloc_space": {Units: "bytes"},
+		},
+	}
+}
+
+func TestFileUpload(t *testing.T) {
+	dir := t.TempDir()
+	f, err := NewFile(Config{Dir: dir, Logger: testutil.NewTestLogger()})
+	require.NoError(t, err)
+
+	f.Upload(testJob(upstream.ProfileNameMemory, testStart))
+	f.Upload(testJob(upstream.ProfileNameMemory, testStart))
+
+	name := filepath.Join(dir, "my-app_memory_20240102T150405Z_20240102T150420Z")
+	profile, err := os.ReadFile(name + ".pprof")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("memory"), profile)
+	_, err = os.Stat(name + "-1.pprof")
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(name + ".json")
+	require.NoError(t, err)
+	var md Metadata
+	require.NoError(t, json.Unmarshal(b, &md))
+	assert.Equal(t, "my-app{foo=bar}", md.Name)
+	assert.Equal(t, upstream.ProfileNameMemory, md.ProfileName)
+	assert.Equal(t, "bar", md.Labels["foo"])
+	assert.True(t, testStart.Equal(md.StartTime))
+	assert.Equal(t, "bytes", md.SampleTypeConfig["alloc_space"].Units)
+}
+
+func TestFileRotationAndRetention(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{
+		Dir:              dir,
+		RotationInterval: time.Hour,
+		MaxAge:           2 * time.Hour,
+		Logger:           testutil.NewTestLogger(),
+	}
+	f, err := NewFile(cfg)
+	require.NoError(t, err)
+	f.now = func() time.Time { return testStart.Add(time.Hour) }
+
+	f.Upload(testJob(upstream.ProfileNameCPU, testStart.Add(-time.Hour)))
+	f.Upload(testJob(upstream.ProfileNameCPU, testStart))
+	_, err = os.Stat(filepath.Join(dir, "20240102T140000Z", "my-app_process_cpu_20240102T140405Z_20240102T140420Z.pprof"))
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "20240102T150000Z", "my-app_process_cpu_20240102T150405Z_20240102T150420Z.pprof"))
+	require.NoError(t, err)
+
+	// Profiles written previously are subject to retention.
+	f, err = NewFile(cfg)
+	require.NoError(t, err)
+	require.Len(t, f.files, 2)
+	f.now = func() time.Time { return testStart.Add(2 * time.Hour) }
+	f.Upload(testJob(upstream.ProfileNameCPU, testStart.Add(2*time.Hour)))
+	_, err = os.Stat(filepath.Join(dir, "20240102T140000Z"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.Len(t, f.files, 2)
+
+	// The oldest profiles are removed when the size limit is exceeded.
+	f.cfg.MaxSize = f.files[1].size
+	f.Upload(testJob(upstream.ProfileNameCPU, testStart.Add(2*time.Hour+15*time.Second)))
+	require.Len(t, f.files, 1)
+	assert.True(t, testStart.Add(2*time.Hour+30*time.Second).Equal(f.files[0].endTime))
+}
+
+func TestFileWithoutLogger(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "invalid.json"), []byte("{"), 0o600))
+	f, err := NewFile(Config{Dir: dir, MaxSize: 1})
+	require.NoError(t, err)
+
+	f.Upload(testJob(upstream.ProfileNameCPU, testStart))
+	assert.Empty(t, f.files)
+}
@@ -0,0 +1,61 @@
+package push
+
+import "encoding/binary"
+
+// The messages below are a subset of the Pyroscope push API
+// (push/v1/push.proto and types/v1/types.proto):
+//
+//	message PushRequest      { repeated RawProfileSeries series = 1; }
+//	message RawProfileSeries { repeated LabelPair labels = 1; repeated RawSample samples = 2; }
+//	message RawSample        { bytes raw_profile = 1; string ID = 2; }
+//	message LabelPair        { string name = 1; string value = 2; }
+const (
+	tagPushRequest_Series = 1
+
+	tagRawProfileSeries_Labels  = 1
+	tagRawProfileSeries_Samples = 2
+
+	tagRawSample_RawProfile = 1
+
+	tagLabelPair_Name  = 1
+	tagLabelPair_Value = 2
+
+	wireTypeBytes = 2
+)
+
+type labelPair struct {
+	name  string
+	value string
+}
+
+type series struct {
+	labels  []labelPair
+	samples [][]byte
+}
+
+func marshalPushRequest(ss []*series) []byte {
+	var b, msg, pair []byte
+	for _, s := range ss {
+		msg = msg[:0]
+		for _, l := range s.labels {
+			pair = appendBytes(pair[:0], tagLabelPair_Name, []byte(l.name))
+			pair = appendBytes(pair, tagLabelPair_Value, []byte(l.value))
+			msg = appendBytes(msg, tagRawProfileSeries_Labels, pair)
+		}
+		for _, p := range s.samples {
+			pair = appendBytes(pair[:0], tagRawSample_RawProfile, p)
+			msg = appendBytes(msg, tagRawProfileSeries_Samples, pair)
+		}
+		b = appendBytes(b, tagPushRequest_Series, msg)
+	}
+
+	return b
+}
+
+// appendBytes appends a length-delimited field to b.
+func appendBytes(b []byte, tag int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(tag)<<3|wireTypeBytes) //nolint:gosec
+	b = binary.AppendUvarint(b, uint64(len(v)))
+
+	return append(b, v...)
+}
@@ -0,0 +1,355 @@
+// Package push implements an upstream that sends profiles to Pyroscope
+// via the push API (push.v1.PusherService/Push), using the Connect
+// protocol with protobuf encoding.
+//
+// Unlike the legacy /ingest endpoint, the push API receives the series
+// labels as a list of pairs, therefore label values are never mangled,
+// and multiple profiles are sent in a single request.
+package push
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/pyroscope-go/internal/labelset"
+	"github.com/grafana/pyroscope-go/internal/logging"
+	"github.com/grafana/pyroscope-go/metrics"
+	"github.com/grafana/pyroscope-go/upstream"
+)
+
+const (
+	pushPath = "push.v1.PusherService/Push"
+
+	labelNameProfileName = "__name__"
+	labelNameServiceName = "service_name"
+	labelNameDelta       = "__delta__"
+	labelNameSpyName     = "pyroscope_spy"
+
+	defaultMaxBatchSize = 16
+)
+
+var errProfileNameRequired = errors.New("profile name is required")
+
+type Pusher struct {
+	mu      sync.Mutex
+	cfg     Config
+	jobs    chan job
+	client  HTTPClient
+	logger  *logging.Logger
+	metrics *metrics.UploadMetrics
+
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	flushWG *sync.WaitGroup
+}
+
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Config configures the Pusher. The push API receives the pprof profiles
+// as is, the sample types are read from the profiles: the SampleTypeConfig,
+// Units, AggregationType and SampleRate of the upload jobs are not sent.
+type Config struct {
+	BasicAuthUser     string // http basic auth user
+	BasicAuthPassword string // http basic auth password
+	TenantID          string
+	HTTPHeaders       map[string]string
+	Threads           int
+	Address           string
+	Timeout           time.Duration
+	Logger            Logger
+	HTTPClient        HTTPClient // optional, custom client
+	// MaxBatchSize limits the number of profiles sent in a single
+	// request. Profiles that are queued at the same time, such as
+	// profiles of different types collected in the same upload
+	// window, are batched together. Defaults to 16.
+	MaxBatchSize int
+	// Metrics receives the upload metrics, optional.
+	Metrics metrics.Metrics
+}
+
+type Logger interface {
+	Infof(_ string, _ ...interface{})
+	Debugf(_ string, _ ...interface{})
+	Errorf(_ string, _ ...interface{})
+}
+
+func NewPusher(cfg Config) (*Pusher, error) {
+	if cfg.MaxBatchSize <= 0 {
+		cfg.MaxBatchSize = defaultMaxBatchSize
+	}
+	if _, err := url.Parse(cfg.Address); err != nil {
+		return nil, err
+	}
+	p := &Pusher{
+		cfg:  cfg,
+		jobs: make(chan job, 20),
+		client: &http.Client{
+			Transport: &http.Transport{
+				MaxConnsPerHost: cfg.Threads,
+			},
+			// Don't follow redirects: the Authorization header
+			// is stripped when redirected to another host.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+			Timeout: cfg.Timeout,
+		},
+		logger:  logging.New(cfg.Logger),
+		metrics: metrics.NewUploadMetrics(cfg.Metrics, cfg.Address),
+		done:    make(chan struct{}),
+		flushWG: new(sync.WaitGroup),
+	}
+	if cfg.HTTPClient != nil {
+		p.client = cfg.HTTPClient
+	}
+
+	return p, nil
+}
+
+func (p *Pusher) Start() {
+	p.wg.Add(p.cfg.Threads)
+	for range p.cfg.Threads {
+		go p.handleJobs()
+	}
+}
+
+func (p *Pusher) Stop() {
+	if p.done != nil {
+		close(p.done)
+	}
+
+	// wait for uploading goroutines exit
+	p.wg.Wait()
+}
+
+func (p *Pusher) Upload(uj *upstream.UploadJob) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.flushWG.Add(1)
+	j := job{
+		upload: uj,
+		flush:  p.flushWG,
+	}
+	select {
+	case p.jobs <- j:
+		p.metrics.SetQueueLength(len(p.jobs))
+	default:
+		j.flush.Done()
+		p.logger.Warn("push upload queue is full, dropping a profile job",
+			"profile_type", uj.ProfileName, "app_name", uj.Name)
+		p.metrics.Dropped(uj.ProfileName, metrics.ReasonQueueFull)
+	}
+}
+
+func (p *Pusher) Flush() {
+	p.mu.Lock()
+	flush := p.flushWG
+	p.flushWG = new(sync.WaitGroup)
+	p.mu.Unlock()
+	flush.Wait()
+}
+
+func (p *Pusher) handleJobs() {
+	defer p.wg.Done()
+	batch := make([]job, 0, p.cfg.MaxBatchSize)
+	for {
+		select {
+		case <-p.done:
+			return
+		case j := <-p.jobs:
+			batch = append(batch[:0], j)
+		drain:
+			for len(batch) < p.cfg.MaxBatchSize {
+				select {
+				case j = <-p.jobs:
+					batch = append(batch, j)
+				default:
+					break drain
+				}
+			}
+			p.metrics.SetQueueLength(len(p.jobs))
+			p.safePush(batch)
+			for _, j = range batch {
+				j.flush.Done()
+			}
+		}
+	}
+}
+
+func (p *Pusher) safePush(batch []job) {
+	defer func() {
+		if catch := recover(); catch != nil {
+			p.logger.Error("push panic", "panic", catch, "stack", string(debug.Stack()))
+		}
+	}()
+
+	jobs := make([]*upstream.UploadJob, 0, len(batch))
+	for _, j := range batch {
+		jobs = append(jobs, j.upload)
+	}
+	start := time.Now()
+	err := p.push(jobs)
+	for _, j := range jobs {
+		p.metrics.ObserveUpload(j.ProfileName, start, err)
+		if err != nil {
+			p.metrics.Dropped(j.ProfileName, metrics.ReasonUploadFailed)
+		}
+	}
+	if err != nil {
+		p.logger.Error("failed to push profiles", "err", err)
+	}
+}
+
+func (p *Pusher) push(jobs []*upstream.UploadJob) error {
+	ss, err := groupSeries(jobs)
+	if err != nil {
+		p.logger.Error("dropping invalid profiles", "err", err)
+	}
+	if len(ss) == 0 {
+		return nil
+	}
+
+	u, err := url.Parse(p.cfg.Address)
+	if err != nil {
+		return fmt.Errorf("url parse: %w", err)
+	}
+	u.Path = path.Join(u.Path, pushPath)
+
+	ctx := context.Background()
+	if p.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.cfg.Timeout)
+		defer cancel()
+	}
+	body := marshalPushRequest(ss)
+	p.logger.Debug("pushing profiles", "url", u.String(), "count", len(jobs))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("new http request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/proto")
+	request.Header.Set("Connect-Protocol-Version", "1")
+	if p.cfg.Timeout > 0 {
+		request.Header.Set("Connect-Timeout-Ms", strconv.FormatInt(p.cfg.Timeout.Milliseconds(), 10))
+	}
+	if p.cfg.BasicAuthUser != "" && p.cfg.BasicAuthPassword != "" {
+		request.SetBasicAuth(p.cfg.BasicAuthUser, p.cfg.BasicAuthPassword)
+	}
+	if p.cfg.TenantID != "" {
+		request.Header.Set("X-Scope-OrgID", p.cfg.TenantID)
+	}
+	for k, v := range p.cfg.HTTPHeaders {
+		request.Header.Set(k, v)
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("do http request: %w", err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	respBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("read response body: %w", err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to push: (%d) '%s'", //nolint:err113
+			response.StatusCode, string(respBody))
+	}
+
+	return nil
+}
+
+// groupSeries groups profiles by their label sets.
+func groupSeries(jobs []*upstream.UploadJob) ([]*series, error) {
+	ss := make([]*series, 0, len(jobs))
+	idx := make(map[string]*series, len(jobs))
+	var errs []error
+	for _, j := range jobs {
+		labels, err := seriesLabels(j)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", j.Name, err))
+
+			continue
+		}
+		k := seriesKey(labels)
+		s, ok := idx[k]
+		if !ok {
+			s = &series{labels: labels}
+			idx[k] = s
+			ss = append(ss, s)
+		}
+		s.samples = append(s.samples, j.Profile)
+	}
+
+	return ss, errors.Join(errs...)
+}
+
+// seriesLabels returns the sorted series labels of the job. The application
+// name is sent as service_name, while __name__ identifies the profile type.
+func seriesLabels(j *upstream.UploadJob) ([]labelPair, error) {
+	if j.ProfileName == "" {
+		return nil, errProfileNameRequired
+	}
+	ls := j.Labels
+	if ls == nil {
+		parsed, err := labelset.Parse(j.Name)
+		if err != nil {
+			return nil, err
+		}
+		ls = parsed.Labels()
+	}
+	labels := make([]labelPair, 0, len(ls)+3)
+	for k, v := range ls {
+		if k == labelset.ReservedLabelNameName {
+			k = labelNameServiceName
+		}
+		labels = append(labels, labelPair{name: k, value: v})
+	}
+	labels = append(labels,
+		labelPair{name: labelNameProfileName, value: j.ProfileName},
+		// Profiles are never cumulative: delta profiles are computed by the SDK.
+		labelPair{name: labelNameDelta, value: "false"},
+	)
+	if _, ok := ls[labelNameSpyName]; !ok && j.SpyName != "" {
+		labels = append(labels, labelPair{name: labelNameSpyName, value: j.SpyName})
+	}
+	slices.SortFunc(labels, func(a, b labelPair) int { return strings.Compare(a.name, b.name) })
+
+	return labels, nil
+}
+
+func seriesKey(labels []labelPair) string {
+	var sb strings.Builder
+	for _, l := range labels {
+		sb.WriteString(l.name)
+		sb.WriteByte(0)
+		sb.WriteString(l.value)
+		sb.WriteByte(0)
+	}
+
+	return sb.String()
+}
+
+type job struct {
+	upload *upstream.UploadJob
+	flush  *sync.WaitGroup
+}
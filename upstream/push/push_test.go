@@ -0,0 +1,198 @@
+package push
+
+import (
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/pyroscope-go/internal/testutil"
+	"github.com/grafana/pyroscope-go/upstream"
+)
+
+func TestPush(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests [][]*series
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/"+pushPath, r.URL.Path)
+		assert.Equal(t, "application/proto", r.Header.Get("Content-Type"))
+		assert.Equal(t, "tenant", r.Header.Get("X-Scope-OrgID"))
+		assert.Equal(t, "value", r.Header.Get("X-Custom"))
+		user, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", user)
+		assert.Equal(t, "password", password)
+		b, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		ss, err := unmarshalPushRequest(b)
+		assert.NoError(t, err)
+		mu.Lock()
+		requests = append(requests, ss)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/proto")
+	}))
+	defer server.Close()
+
+	p, err := NewPusher(Config{
+		BasicAuthUser:     "user",
+		BasicAuthPassword: "password",
+		TenantID:          "tenant",
+		HTTPHeaders:       map[string]string{"X-Custom": "value"},
+		Threads:           1,
+		Address:           server.URL,
+		Timeout:           10 * time.Second,
+		Logger:            testutil.NewTestLogger(),
+	})
+	require.NoError(t, err)
+
+	labels := map[string]string{
+		"__name__": "app",
+		"foo":      "a,b=c}",
+	}
+	// Queued before start to be sent in a single batch.
+	p.Upload(&upstream.UploadJob{
+		Name:        "app{foo=a}",
+		ProfileName: upstream.ProfileNameMemory,
+		Labels:      labels,
+		SpyName:     "gospy",
+		Profile:     []byte("memory"),
+	})
+	p.Upload(&upstream.UploadJob{
+		Name:        "app{foo=a}",
+		ProfileName: upstream.ProfileNameMutex,
+		Labels:      labels,
+		SpyName:     "gospy",
+		Profile:     []byte("mutex"),
+	})
+	p.Upload(&upstream.UploadJob{
+		Name:        "legacy{bar=baz}",
+		ProfileName: upstream.ProfileNameCPU,
+		Profile:     []byte("cpu"),
+	})
+	p.Start()
+	p.Flush()
+	p.Stop()
+
+	require.Len(t, requests, 1)
+	require.Len(t, requests[0], 3)
+	assert.Equal(t, []labelPair{
+		{"__delta__", "false"},
+		{"__name__", "memory"},
+		{"foo", "a,b=c}"},
+		{"pyroscope_spy", "gospy"},
+		{"service_name", "app"},
+	}, requests[0][0].labels)
+	assert.Equal(t, [][]byte{[]byte("memory")}, requests[0][0].samples)
+	assert.Equal(t, "mutex", labelValue(requests[0][1].labels, "__name__"))
+	assert.Equal(t, [][]byte{[]byte("mutex")}, requests[0][1].samples)
+	assert.Equal(t, []labelPair{
+		{"__delta__", "false"},
+		{"__name__", "process_cpu"},
+		{"bar", "baz"},
+		{"service_name", "legacy"},
+	}, requests[0][2].labels)
+}
+
+func TestPushWithoutLogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	p, err := NewPusher(Config{Threads: 1, Address: server.URL})
+	require.NoError(t, err)
+	p.Start()
+	defer p.Stop()
+	p.Upload(&upstream.UploadJob{Name: "app", Profile: []byte("invalid")})
+	p.Upload(&upstream.UploadJob{Name: "app", ProfileName: upstream.ProfileNameCPU, Profile: []byte("cpu")})
+	p.Flush()
+}
+
+func TestGroupSeries(t *testing.T) {
+	labels := map[string]string{"__name__": "app"}
+	ss, err := groupSeries([]*upstream.UploadJob{
+		{ProfileName: upstream.ProfileNameCPU, Labels: labels, Profile: []byte("1")},
+		{ProfileName: upstream.ProfileNameCPU, Labels: labels, Profile: []byte("2")},
+		{Name: "no-profile-name", Labels: labels, Profile: []byte("3")},
+	})
+	require.ErrorIs(t, err, errProfileNameRequired)
+	require.Len(t, ss, 1)
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("2")}, ss[0].samples)
+}
+
+func labelValue(labels []labelPair, name string) string {
+	for _, l := range labels {
+		if l.name == name {
+			return l.value
+		}
+	}
+
+	return ""
+}
+
+func unmarshalPushRequest(b []byte) ([]*series, error) {
+	var ss []*series
+	err := forEachField(b, func(_ int, v []byte) error {
+		s := new(series)
+		ss = append(ss, s)
+
+		return forEachField(v, func(tag int, v []byte) error {
+			switch tag {
+			case tagRawProfileSeries_Labels:
+				var l labelPair
+				err := forEachField(v, func(tag int, v []byte) error {
+					if tag == tagLabelPair_Name {
+						l.name = string(v)
+					} else {
+						l.value = string(v)
+					}
+
+					return nil
+				})
+				s.labels = append(s.labels, l)
+
+				return err
+			case tagRawProfileSeries_Samples:
+				return forEachField(v, func(_ int, v []byte) error {
+					s.samples = append(s.samples, v)
+
+					return nil
+				})
+			}
+
+			return nil
+		})
+	})
+
+	return ss, err
+}
+
+// forEachField decodes a message consisting of length-delimited fields only.
+func forEachField(b []byte, fn func(tag int, v []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 || key&7 != wireTypeBytes {
+			return io.ErrUnexpectedEOF
+		}
+		b = b[n:]
+		size, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < size {
+			return io.ErrUnexpectedEOF
+		}
+		b = b[n:]
+		if err := fn(int(key>>3), b[:size]); err != nil { //nolint:gosec
+			return err
+		}
+		b = b[size:]
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package remote
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content encodings of the request bodies, see Config.ContentEncoding.
+const (
+	ContentEncodingGzip = "gzip"
+	ContentEncodingZstd = "zstd"
+)
+
+var errUnknownContentEncoding = errors.New("unknown content encoding")
+
+// bodyEncoder compresses the request bodies with the content encoding.
+type bodyEncoder struct {
+	encoding string
+	zstd     *zstd.Encoder // safe for concurrent EncodeAll calls
+}
+
+func newBodyEncoder(encoding string) (*bodyEncoder, error) {
+	e := &bodyEncoder{encoding: encoding}
+	switch encoding {
+	case "", ContentEncodingGzip:
+	case ContentEncodingZstd:
+		var err error
+		if e.zstd, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w %q", errUnknownContentEncoding, encoding)
+	}
+
+	return e, nil
+}
+
+// encode returns the compressed body.
+func (e *bodyEncoder) encode(body *bytes.Buffer) (*bytes.Buffer, error) {
+	switch e.encoding {
+	case ContentEncodingGzip:
+		return gzipBytes(body.Bytes())
+	case ContentEncodingZstd:
+		return bytes.NewBuffer(e.zstd.EncodeAll(body.Bytes(), make([]byte, 0, body.Len()/2))), nil
+	default:
+		return body, nil
+	}
+}
+
+func gzipBytes(b []byte) (*bytes.Buffer, error) {
+	encoded := bytes.NewBuffer(make([]byte, 0, len(b)/2))
+	zw, _ := gzip.NewWriterLevel(encoded, gzip.BestSpeed)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return encoded, nil
+}
+
+// isGzip reports whether the profile is already gzip-compressed,
+// as the CPU profiles and, by default, the godeltaprof profiles are.
+func isGzip(profile []byte) bool {
+	return len(profile) > 1 && profile[0] == 0x1f && profile[1] == 0x8b
+}
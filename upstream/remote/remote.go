@@ -15,8 +15,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/grafana/pyroscope-go/internal/logging"
+	"github.com/grafana/pyroscope-go/metrics"
 	"github.com/grafana/pyroscope-go/upstream"
 )
 
@@ -32,11 +35,17 @@ const (
 )
 
 type Remote struct {
-	mu     sync.Mutex
-	cfg    Config
-	jobs   chan job
-	client HTTPClient
-	logger Logger
+	mu      sync.Mutex
+	cfg     Config
+	jobs    chan job
+	client  HTTPClient
+	logger  *logging.Logger
+	spool   *spool
+	metrics *metrics.UploadMetrics
+	encoder *bodyEncoder
+	// unsupportedEncoding is set once the server rejects
+	// the content encoding of the request bodies.
+	unsupportedEncoding atomic.Bool
 
 	done chan struct{}
 	wg   sync.WaitGroup
@@ -61,6 +70,21 @@ type Config struct {
 	Timeout           time.Duration
 	Logger            Logger
 	HTTPClient        HTTPClient // optional, custom client
+	// Retry configures retries of failed uploads. Retries are disabled
+	// by default. All attempts of a single upload are bounded by Timeout.
+	Retry RetryConfig
+	// Spool configures the on-disk spool of profiles that could
+	// not be uploaded. Spooling is disabled by default.
+	Spool SpoolConfig
+	// Metrics receives the upload metrics, optional.
+	Metrics metrics.Metrics
+	// ContentEncoding, if set to ContentEncodingGzip or ContentEncodingZstd,
+	// compresses the request bodies, with the matching Content-Encoding
+	// header. Profiles that are already gzip-compressed are sent as is,
+	// so that they are not compressed twice. If the server responds with
+	// 415 Unsupported Media Type, the encoding is disabled and the profiles
+	// are gzip-compressed instead. Not compressed by default.
+	ContentEncoding string
 }
 
 type Logger interface {
@@ -87,13 +111,15 @@ func NewRemote(cfg Config) (*Remote, error) {
 			},
 			Timeout: cfg.Timeout,
 		},
-		logger:  cfg.Logger,
+		logger:  logging.New(cfg.Logger),
+		metrics: metrics.NewUploadMetrics(cfg.Metrics, cfg.Address),
 		done:    make(chan struct{}),
 		flushWG: new(sync.WaitGroup),
 	}
 	if cfg.HTTPClient != nil {
 		r.client = cfg.HTTPClient
 	}
+	r.cfg.Retry = cfg.Retry.withDefaults()
 
 	// parse the upstream address
 	u, err := url.Parse(cfg.Address)
@@ -106,6 +132,16 @@ func NewRemote(cfg Config) (*Remote, error) {
 		return nil, errCloudTokenRequired
 	}
 
+	if r.encoder, err = newBodyEncoder(cfg.ContentEncoding); err != nil {
+		return nil, err
+	}
+
+	if cfg.Spool.Dir != "" {
+		if r.spool, err = openSpool(cfg.Spool); err != nil {
+			return nil, err
+		}
+	}
+
 	return r, nil
 }
 
@@ -114,6 +150,10 @@ func (r *Remote) Start() {
 	for range r.cfg.Threads {
 		go r.handleJobs()
 	}
+	if r.spool != nil {
+		r.wg.Add(1)
+		go r.replaySpool()
+	}
 }
 
 func (r *Remote) Stop() {
@@ -123,6 +163,19 @@ func (r *Remote) Stop() {
 
 	// wait for uploading goroutines exit
 	r.wg.Wait()
+
+	if r.spool != nil {
+		// Keep the jobs that have not been uploaded for the next run.
+		for {
+			select {
+			case j := <-r.jobs:
+				r.spoolJob(j.upload)
+				j.flush.Done()
+			default:
+				return
+			}
+		}
+	}
 }
 
 func (r *Remote) Upload(uj *upstream.UploadJob) {
@@ -135,9 +188,17 @@ func (r *Remote) Upload(uj *upstream.UploadJob) {
 	}
 	select {
 	case r.jobs <- j:
+		r.metrics.SetQueueLength(len(r.jobs))
 	default:
 		j.flush.Done()
-		r.logger.Errorf("remote upload queue is full, dropping a profile job")
+		if r.spool != nil {
+			r.spoolJob(uj)
+
+			return
+		}
+		r.logger.Warn("remote upload queue is full, dropping a profile job",
+			"profile_type", uj.ProfileName, "app_name", uj.Name)
+		r.metrics.Dropped(uj.ProfileName, metrics.ReasonQueueFull)
 	}
 }
 
@@ -149,7 +210,40 @@ func (r *Remote) Flush() {
 	flush.Wait()
 }
 
-func (r *Remote) uploadProfile(j *upstream.UploadJob) error {
+func (r *Remote) uploadProfile(ctx context.Context, j *upstream.UploadJob) error {
+	start := time.Now()
+	err := r.sendProfile(ctx, j)
+	r.metrics.ObserveUpload(j.ProfileName, start, err)
+
+	return err
+}
+
+func (r *Remote) sendProfile(ctx context.Context, j *upstream.UploadJob) error {
+	encoding := r.contentEncoding(j.Profile)
+	err := r.send(ctx, j, encoding)
+	var se *statusError
+	if encoding != "" && errors.As(err, &se) && se.statusCode == http.StatusUnsupportedMediaType {
+		if !r.unsupportedEncoding.Swap(true) {
+			r.logger.Warn("server does not support the content encoding, uploading gzip-compressed profiles",
+				"content_encoding", encoding)
+		}
+		err = r.send(ctx, j, "")
+	}
+
+	return err
+}
+
+// contentEncoding returns the content encoding of the request body of the
+// profile, empty if the body is not compressed.
+func (r *Remote) contentEncoding(profile []byte) string {
+	if r.cfg.ContentEncoding == "" || r.unsupportedEncoding.Load() || isGzip(profile) {
+		return ""
+	}
+
+	return r.cfg.ContentEncoding
+}
+
+func (r *Remote) send(ctx context.Context, j *upstream.UploadJob, encoding string) error {
 	u, err := url.Parse(r.cfg.Address)
 	if err != nil {
 		return fmt.Errorf("url parse: %w", err)
@@ -162,7 +256,17 @@ func (r *Remote) uploadProfile(j *upstream.UploadJob) error {
 	if err != nil {
 		return err
 	}
-	_, _ = fw.Write(j.Profile)
+	profile := j.Profile
+	if encoding == "" && r.cfg.ContentEncoding != "" && !isGzip(profile) {
+		// The profile is uncompressed because the request body was
+		// expected to be, but the server does not support the encoding.
+		var compressed *bytes.Buffer
+		if compressed, err = gzipBytes(profile); err != nil {
+			return fmt.Errorf("compress profile: %w", err)
+		}
+		profile = compressed.Bytes()
+	}
+	_, _ = fw.Write(profile)
 	if j.SampleTypeConfig != nil {
 		fw, err = writer.CreateFormFile("sample_type_config", "sample_type_config.json")
 		if err != nil {
@@ -177,6 +281,11 @@ func (r *Remote) uploadProfile(j *upstream.UploadJob) error {
 	if err = writer.Close(); err != nil {
 		return err
 	}
+	if encoding != "" {
+		if body, err = r.encoder.encode(body); err != nil {
+			return fmt.Errorf("encode body: %w", err)
+		}
+	}
 
 	q := u.Query()
 	q.Set("name", j.Name)
@@ -190,15 +299,17 @@ func (r *Remote) uploadProfile(j *upstream.UploadJob) error {
 	u.Path = path.Join(u.Path, "ingest")
 	u.RawQuery = q.Encode()
 
-	r.logger.Debugf("uploading at %s", u.String())
+	r.logger.Debug("uploading profile", "url", u.String(), "profile_type", j.ProfileName)
 	// new a request for the job
-	request, err := http.NewRequestWithContext(context.Background(), http.MethodPost, u.String(), body)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), body)
 	if err != nil {
 		return fmt.Errorf("new http request: %w", err)
 	}
 	contentType := writer.FormDataContentType()
-	r.logger.Debugf("content type: %s", contentType)
 	request.Header.Set("Content-Type", contentType)
+	if encoding != "" {
+		request.Header.Set("Content-Encoding", encoding)
+	}
 	// request.Header.Set("Content-Type", "binary/octet-stream+"+string(j.Format))
 
 	switch {
@@ -208,7 +319,7 @@ func (r *Remote) uploadProfile(j *upstream.UploadJob) error {
 		request.SetBasicAuth(r.cfg.BasicAuthUser, r.cfg.BasicAuthPassword)
 	case r.cfg.AuthToken != "":
 		request.Header.Set("Authorization", "Bearer "+r.cfg.AuthToken)
-		r.logger.Infof(authTokenDeprecationWarning)
+		r.logger.Warn(authTokenDeprecationWarning)
 	}
 	if r.cfg.TenantID != "" {
 		request.Header.Set("X-Scope-OrgID", r.cfg.TenantID)
@@ -233,8 +344,11 @@ func (r *Remote) uploadProfile(j *upstream.UploadJob) error {
 	}
 
 	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to upload: (%d) '%s'", //nolint:err113
-			response.StatusCode, string(respBody))
+		return &statusError{
+			statusCode: response.StatusCode,
+			body:       string(respBody),
+			retryAfter: parseRetryAfter(response.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 
 	return nil
@@ -249,6 +363,7 @@ func (r *Remote) handleJobs() {
 
 			return
 		case j := <-r.jobs:
+			r.metrics.SetQueueLength(len(r.jobs))
 			r.safeUpload(j.upload)
 			j.flush.Done()
 		}
@@ -263,16 +378,71 @@ func isOGPyroscopeCloud(u *url.URL) bool {
 func (r *Remote) safeUpload(job *upstream.UploadJob) {
 	defer func() {
 		if catch := recover(); catch != nil {
-			r.logger.Errorf("recover stack: %v: %v", catch, string(debug.Stack()))
+			r.logger.Error("upload panic", "panic", catch, "stack", string(debug.Stack()))
 		}
 	}()
 
+	ctx, cancel := r.uploadContext()
+	defer cancel()
+
 	// update the profile data to server
-	if err := r.uploadProfile(job); err != nil {
-		r.logger.Errorf("upload profile: %v", err)
+	if err := r.uploadWithRetries(ctx, job); err != nil {
+		r.logger.Error("failed to upload profile", uploadErrorAttrs(job, err)...)
+		if r.shouldSpool(err) {
+			r.spoolJob(job)
+		} else {
+			r.metrics.Dropped(job.ProfileName, metrics.ReasonUploadFailed)
+		}
 	}
 }
 
+// uploadContext returns the context bounding all upload attempts of a job.
+func (r *Remote) uploadContext() (context.Context, context.CancelFunc) {
+	if r.cfg.Timeout > 0 {
+		return context.WithTimeout(context.Background(), r.cfg.Timeout)
+	}
+
+	return context.WithCancel(context.Background())
+}
+
+func (r *Remote) uploadWithRetries(ctx context.Context, job *upstream.UploadJob) error {
+	for attempt := 1; ; attempt++ {
+		err := r.uploadProfile(ctx, job)
+		if err == nil || attempt >= r.cfg.Retry.MaxAttempts || !r.cfg.Retry.retryable(err) {
+			return err
+		}
+		d := r.cfg.Retry.backoff(attempt, err)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+		r.logger.Debug("upload attempt failed, retrying",
+			"profile_type", job.ProfileName, "attempt", attempt, "backoff", d, "err", err)
+		// Stop must not wait for the backoff: the in-flight
+		// attempt is the only one allowed to complete.
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+			continue
+		case <-ctx.Done():
+		case <-r.done:
+		}
+		t.Stop()
+
+		return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+	}
+}
+
+// uploadErrorAttrs returns the log attributes describing a failed upload.
+func uploadErrorAttrs(j *upstream.UploadJob, err error) []any {
+	attrs := []any{"profile_type", j.ProfileName, "app_name", j.Name, "err", err}
+	var se *statusError
+	if errors.As(err, &se) {
+		attrs = append(attrs, "status_code", se.statusCode)
+	}
+
+	return attrs
+}
+
 type job struct {
 	upload *upstream.UploadJob
 	flush  *sync.WaitGroup
@@ -2,6 +2,8 @@ package remote
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,12 +11,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/require"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
+	"github.com/grafana/pyroscope-go/internal/logging"
 	"github.com/grafana/pyroscope-go/internal/testutil"
+	"github.com/grafana/pyroscope-go/metrics"
 	"github.com/grafana/pyroscope-go/upstream"
 )
 
@@ -67,12 +72,13 @@ func TestUploadProfile(t *testing.T) {
 			}, nil)
 
 			r := &Remote{
-				cfg:    tt.cfg,
-				client: mockClient,
-				logger: logger,
+				cfg:     tt.cfg,
+				client:  mockClient,
+				logger:  logging.New(logger),
+				metrics: metrics.NewUploadMetrics(nil, ""),
 			}
 
-			err := r.uploadProfile(&upstream.UploadJob{
+			err := r.uploadProfile(context.Background(), &upstream.UploadJob{
 				Name:       "test-profile",
 				StartTime:  time.Now(),
 				EndTime:    time.Now().Add(time.Minute),
@@ -97,6 +103,134 @@ func TestUploadProfile(t *testing.T) {
 	}
 }
 
+func TestUploadProfileContentEncoding(t *testing.T) {
+	decoders := map[string]func(r io.Reader) (io.Reader, error){
+		"": func(r io.Reader) (io.Reader, error) { return r, nil },
+		ContentEncodingGzip: func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+		ContentEncodingZstd: func(r io.Reader) (io.Reader, error) {
+			return zstd.NewReader(r)
+		},
+	}
+	for encoding, decode := range decoders {
+		t.Run(encoding, func(t *testing.T) {
+			mockClient := new(MockHTTPClient)
+			var (
+				header string
+				body   []byte
+			)
+			mockClient.On("Do", mock.Anything).Run(func(args mock.Arguments) {
+				req := args.Get(0).(*http.Request) //nolint:forcetypeassert
+				header = req.Header.Get("Content-Encoding")
+				r, err := decode(req.Body)
+				require.NoError(t, err)
+				body, err = io.ReadAll(r)
+				require.NoError(t, err)
+			}).Return(&http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString("OK")),
+			}, nil)
+
+			encoder, err := newBodyEncoder(encoding)
+			require.NoError(t, err)
+			r := &Remote{
+				cfg:     Config{Address: "https://example.com", ContentEncoding: encoding},
+				client:  mockClient,
+				logger:  logging.New(testutil.NewTestLogger()),
+				metrics: metrics.NewUploadMetrics(nil, ""),
+				encoder: encoder,
+			}
+			err = r.uploadProfile(context.Background(), &upstream.UploadJob{
+				Name:    "test-profile",
+				Profile: []byte("test profile data"),
+			})
+			require.NoError(t, err)
+			assert.Equal(t, encoding, header)
+			assert.Contains(t, string(body), "test profile data")
+		})
+	}
+}
+
+func TestUploadGzipProfileContentEncoding(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	var header string
+	mockClient.On("Do", mock.Anything).Run(func(args mock.Arguments) {
+		header = args.Get(0).(*http.Request).Header.Get("Content-Encoding") //nolint:forcetypeassert
+	}).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewBufferString("OK")),
+	}, nil)
+
+	r, err := NewRemote(Config{Address: "https://example.com", ContentEncoding: ContentEncodingZstd})
+	require.NoError(t, err)
+	r.client = mockClient
+	profile, err := gzipBytes([]byte("test profile data"))
+	require.NoError(t, err)
+	err = r.uploadProfile(context.Background(), &upstream.UploadJob{
+		Name:    "test-profile",
+		Profile: profile.Bytes(),
+	})
+	require.NoError(t, err)
+	assert.Empty(t, header, "gzip-compressed profiles must not be compressed twice")
+}
+
+func TestUploadProfileUnsupportedContentEncoding(t *testing.T) {
+	mockClient := new(MockHTTPClient)
+	var (
+		headers  []string
+		profiles [][]byte
+	)
+	record := func(args mock.Arguments) {
+		req := args.Get(0).(*http.Request) //nolint:forcetypeassert
+		headers = append(headers, req.Header.Get("Content-Encoding"))
+		if req.Header.Get("Content-Encoding") != "" {
+			return
+		}
+		require.NoError(t, req.ParseMultipartForm(1<<20))
+		f, _, err := req.FormFile("profile")
+		require.NoError(t, err)
+		b, err := io.ReadAll(f)
+		require.NoError(t, err)
+		profiles = append(profiles, b)
+	}
+	mockClient.On("Do", mock.Anything).Run(record).Return(&http.Response{
+		StatusCode: http.StatusUnsupportedMediaType,
+		Body:       io.NopCloser(bytes.NewBufferString("unsupported content encoding")),
+	}, nil).Once()
+	mockClient.On("Do", mock.Anything).Run(record).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewBufferString("OK")),
+	}, nil)
+
+	r, err := NewRemote(Config{Address: "https://example.com", ContentEncoding: ContentEncodingZstd})
+	require.NoError(t, err)
+	r.client = mockClient
+	for range 2 {
+		err = r.uploadProfile(context.Background(), &upstream.UploadJob{
+			Name:    "test-profile",
+			Profile: []byte("test profile data"),
+		})
+		require.NoError(t, err)
+	}
+
+	// The second upload does not try the encoding again.
+	assert.Equal(t, []string{ContentEncodingZstd, "", ""}, headers)
+	require.Len(t, profiles, 2)
+	for _, p := range profiles {
+		zr, err := gzip.NewReader(bytes.NewReader(p))
+		require.NoError(t, err)
+		b, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		assert.Equal(t, "test profile data", string(b))
+	}
+}
+
+func TestNewRemoteUnknownContentEncoding(t *testing.T) {
+	_, err := NewRemote(Config{Address: "https://example.com", ContentEncoding: "br"})
+	require.ErrorIs(t, err, errUnknownContentEncoding)
+}
+
 type MockHTTPClient struct {
 	mock.Mock
 }
@@ -0,0 +1,126 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryBaseBackoff = 500 * time.Millisecond
+	defaultRetryMaxBackoff  = 10 * time.Second
+)
+
+// DefaultRetryableStatusCodes lists HTTP status codes that are retried
+// when RetryConfig.RetryableStatusCodes is not specified.
+var DefaultRetryableStatusCodes = []int{ //nolint:gochecknoglobals
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryConfig configures retries of failed uploads with exponential
+// backoff. Transport errors (e.g. connection reset) and responses with
+// one of RetryableStatusCodes are retried; other failures are not.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of upload attempts per profile,
+	// including the first one. Values less than 2 disable retries.
+	MaxAttempts int
+	// BaseBackoff is the delay before the first retry, doubled on every
+	// following attempt. Defaults to 500ms.
+	BaseBackoff time.Duration
+	// MaxBackoff caps the delay between attempts. Defaults to 10s.
+	MaxBackoff time.Duration
+	// Jitter is the fraction of the delay, in the [0, 1] range, that is
+	// randomized to avoid synchronized retries of many clients.
+	Jitter float64
+	// RetryableStatusCodes overrides DefaultRetryableStatusCodes.
+	RetryableStatusCodes []int
+	// IgnoreRetryAfter disables respecting the Retry-After response header,
+	// which otherwise takes precedence over the computed backoff.
+	IgnoreRetryAfter bool
+}
+
+func (c RetryConfig) withDefaults() RetryConfig {
+	if c.BaseBackoff <= 0 {
+		c.BaseBackoff = defaultRetryBaseBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if c.MaxBackoff < c.BaseBackoff {
+		c.MaxBackoff = c.BaseBackoff
+	}
+	c.Jitter = min(max(c.Jitter, 0), 1)
+	if c.RetryableStatusCodes == nil {
+		c.RetryableStatusCodes = DefaultRetryableStatusCodes
+	}
+
+	return c
+}
+
+// retryable reports whether the upload failed with err may be retried.
+func (c RetryConfig) retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return slices.Contains(c.RetryableStatusCodes, se.statusCode)
+	}
+	// Request encoding errors are not expected here, therefore
+	// anything else is a transport error worth retrying.
+	return true
+}
+
+// backoff returns the delay before the attempt following the given one.
+func (c RetryConfig) backoff(attempt int, err error) time.Duration {
+	var se *statusError
+	if !c.IgnoreRetryAfter && errors.As(err, &se) && se.retryAfter > 0 {
+		return se.retryAfter
+	}
+	d := c.BaseBackoff
+	for i := 1; i < attempt && d < c.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, c.MaxBackoff)
+	if c.Jitter > 0 {
+		d -= time.Duration(c.Jitter * rand.Float64() * float64(d)) //nolint:gosec
+	}
+
+	return d
+}
+
+// statusError is returned when the server responds with a non-200 status.
+type statusError struct {
+	statusCode int
+	body       string
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("failed to upload: (%d) '%s'", e.statusCode, e.body)
+}
+
+// parseRetryAfter parses the Retry-After header value, which is either
+// a number of seconds or an HTTP date. Zero is returned if the value is
+// missing or malformed.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(s)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0)
+	}
+
+	return 0
+}
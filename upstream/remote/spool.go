@@ -0,0 +1,270 @@
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/pyroscope-go/metrics"
+	"github.com/grafana/pyroscope-go/upstream"
+)
+
+const (
+	defaultSpoolMaxSize        = 64 << 20
+	defaultSpoolMaxAge         = time.Hour
+	defaultSpoolReplayInterval = 10 * time.Second
+
+	spoolEntryExt    = ".job"
+	spoolTempPattern = ".tmp-*"
+)
+
+// SpoolConfig configures the on-disk spool of profiles that could not be
+// uploaded: jobs that failed with a retryable error, and jobs that did not
+// fit into the upload queue. Spooled jobs are replayed in order once the
+// server is reachable again, and removed after they are acknowledged.
+// Spooled jobs survive process restarts.
+type SpoolConfig struct {
+	// Dir is the spool directory. Spooling is disabled if empty.
+	Dir string
+	// MaxSize limits the total size of spooled jobs in bytes; the oldest
+	// jobs are discarded when the limit is exceeded. Defaults to 64MiB.
+	MaxSize int64
+	// MaxAge is the age after which spooled jobs are discarded.
+	// Defaults to 1h.
+	MaxAge time.Duration
+	// ReplayInterval is the interval between attempts to replay spooled
+	// jobs. Defaults to 10s.
+	ReplayInterval time.Duration
+}
+
+func (c SpoolConfig) withDefaults() SpoolConfig {
+	if c.MaxSize <= 0 {
+		c.MaxSize = defaultSpoolMaxSize
+	}
+	if c.MaxAge <= 0 {
+		c.MaxAge = defaultSpoolMaxAge
+	}
+	if c.ReplayInterval <= 0 {
+		c.ReplayInterval = defaultSpoolReplayInterval
+	}
+
+	return c
+}
+
+type spool struct {
+	mu  sync.Mutex
+	cfg SpoolConfig
+	seq uint64
+	now func() time.Time
+}
+
+type spoolEntry struct {
+	name    string
+	created time.Time
+	size    int64
+}
+
+func openSpool(cfg SpoolConfig) (*spool, error) {
+	cfg = cfg.withDefaults()
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create spool directory: %w", err)
+	}
+	// Remove leftovers of writes interrupted by a crash.
+	tmp, _ := filepath.Glob(filepath.Join(cfg.Dir, spoolTempPattern))
+	for _, f := range tmp {
+		_ = os.Remove(f)
+	}
+
+	return &spool{cfg: cfg, now: time.Now}, nil
+}
+
+// put writes the job to the spool and discards the oldest entries
+// if the spool size limit is exceeded.
+func (s *spool) put(j *upstream.UploadJob) error {
+	b, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.CreateTemp(s.cfg.Dir, spoolTempPattern)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+
+		return err
+	}
+	// Names sort in the order the entries were written,
+	// including entries written by previous processes.
+	s.seq++
+	name := fmt.Sprintf("%020d-%08d%s", s.now().UnixNano(), s.seq%1e8, spoolEntryExt)
+	if err = os.Rename(f.Name(), filepath.Join(s.cfg.Dir, name)); err != nil {
+		_ = os.Remove(f.Name())
+
+		return err
+	}
+	s.enforceLimits()
+
+	return nil
+}
+
+// entries returns the spooled entries, oldest first. Expired entries are
+// removed.
+func (s *spool) entries() []spoolEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.enforceLimits()
+}
+
+func (s *spool) enforceLimits() []spoolEntry {
+	all := s.list()
+	var size int64
+	for _, e := range all {
+		size += e.size
+	}
+	deadline := s.now().Add(-s.cfg.MaxAge)
+	live := all[:0]
+	for _, e := range all {
+		if e.created.Before(deadline) || size > s.cfg.MaxSize {
+			s.remove(e.name)
+			size -= e.size
+
+			continue
+		}
+		live = append(live, e)
+	}
+
+	return live
+}
+
+func (s *spool) list() []spoolEntry {
+	files, err := os.ReadDir(s.cfg.Dir)
+	if err != nil {
+		return nil
+	}
+	entries := make([]spoolEntry, 0, len(files))
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, spoolEntryExt) {
+			continue
+		}
+		ts, _, _ := strings.Cut(name, "-")
+		ns, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, spoolEntry{
+			name:    name,
+			created: time.Unix(0, ns),
+			size:    info.Size(),
+		})
+	}
+	slices.SortFunc(entries, func(a, b spoolEntry) int { return strings.Compare(a.name, b.name) })
+
+	return entries
+}
+
+func (s *spool) load(e spoolEntry) (*upstream.UploadJob, error) {
+	b, err := os.ReadFile(filepath.Join(s.cfg.Dir, e.name))
+	if err != nil {
+		return nil, err
+	}
+	var j upstream.UploadJob
+	if err = json.Unmarshal(b, &j); err != nil {
+		return nil, err
+	}
+
+	return &j, nil
+}
+
+func (s *spool) remove(name string) { _ = os.Remove(filepath.Join(s.cfg.Dir, name)) }
+
+func (r *Remote) spoolJob(j *upstream.UploadJob) {
+	if err := r.spool.put(j); err != nil {
+		r.logger.Error("failed to spool a profile job, dropping it", "profile_type", j.ProfileName, "err", err)
+		r.metrics.Dropped(j.ProfileName, metrics.ReasonSpoolFailed)
+
+		return
+	}
+	r.logger.Debug("profile job spooled", "profile_type", j.ProfileName)
+}
+
+// shouldSpool reports whether a job that failed with err should be
+// spooled: the server is expected to reject it again only if it responded
+// with a status that is not retryable.
+func (r *Remote) shouldSpool(err error) bool {
+	if r.spool == nil {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return slices.Contains(r.cfg.Retry.RetryableStatusCodes, se.statusCode)
+	}
+
+	return true
+}
+
+func (r *Remote) replaySpool() {
+	defer r.wg.Done()
+	t := time.NewTicker(r.spool.cfg.ReplayInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-t.C:
+			r.replaySpooledJobs()
+		}
+	}
+}
+
+// replaySpooledJobs uploads spooled jobs in order, and stops at
+// the first one that fails and is worth retrying later.
+func (r *Remote) replaySpooledJobs() {
+	for _, e := range r.spool.entries() {
+		select {
+		case <-r.done:
+			return
+		default:
+		}
+		j, err := r.spool.load(e)
+		if err != nil {
+			r.logger.Error("failed to load spooled profile job, dropping it", "file", e.name, "err", err)
+			r.spool.remove(e.name)
+
+			continue
+		}
+		ctx, cancel := r.uploadContext()
+		err = r.uploadProfile(ctx, j)
+		cancel()
+		if err != nil && r.shouldSpool(err) {
+			r.logger.Debug("failed to replay spooled profile job", uploadErrorAttrs(j, err)...)
+
+			return
+		}
+		if err != nil {
+			r.logger.Error("failed to replay spooled profile job, dropping it", uploadErrorAttrs(j, err)...)
+			r.metrics.Dropped(j.ProfileName, metrics.ReasonUploadFailed)
+		}
+		r.spool.remove(e.name)
+	}
+}
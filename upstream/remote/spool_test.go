@@ -0,0 +1,123 @@
+package remote
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/pyroscope-go/internal/testutil"
+	"github.com/grafana/pyroscope-go/upstream"
+)
+
+func TestSpoolOrderAndLimits(t *testing.T) {
+	s, err := openSpool(SpoolConfig{Dir: t.TempDir(), MaxAge: time.Minute})
+	require.NoError(t, err)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, s.put(&upstream.UploadJob{
+			Name:    name,
+			Profile: []byte(name),
+			SampleTypeConfig: map[string]*upstream.SampleType{
+				"alloc_space": {Units: "bytes"},
+			},
+		}))
+		now = now.Add(time.Second)
+	}
+
+	entries := s.entries()
+	require.Len(t, entries, 3)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		j, err := s.load(e)
+		require.NoError(t, err)
+		assert.Equal(t, []byte(j.Name), j.Profile)
+		assert.Equal(t, "bytes", j.SampleTypeConfig["alloc_space"].Units)
+		names = append(names, j.Name)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+
+	// The oldest entry is evicted when the size limit is exceeded.
+	s.cfg.MaxSize = entries[0].size + entries[1].size
+	entries = s.entries()
+	require.Len(t, entries, 2)
+	j, err := s.load(entries[0])
+	require.NoError(t, err)
+	assert.Equal(t, "b", j.Name)
+
+	// Expired entries are discarded.
+	now = now.Add(time.Minute - time.Second)
+	entries = s.entries()
+	require.Len(t, entries, 1)
+	j, err = s.load(entries[0])
+	require.NoError(t, err)
+	assert.Equal(t, "c", j.Name)
+}
+
+func TestSpoolReplay(t *testing.T) {
+	dir := t.TempDir()
+	var calls atomic.Int32
+	var available atomic.Bool
+	client := httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		calls.Add(1)
+		if !available.Load() {
+			return nil, syscall.ECONNRESET
+		}
+
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(""))}, nil
+	})
+
+	r, err := NewRemote(Config{
+		Threads:    1,
+		Logger:     testutil.NewTestLogger(),
+		HTTPClient: client,
+		Spool:      SpoolConfig{Dir: dir, ReplayInterval: 10 * time.Millisecond},
+	})
+	require.NoError(t, err)
+	r.Start()
+	r.Upload(newJob("test"))
+	r.Flush()
+	require.Len(t, r.spool.entries(), 1)
+
+	available.Store(true)
+	require.Eventually(t, func() bool { return len(r.spool.entries()) == 0 }, 5*time.Second, 10*time.Millisecond)
+	r.Stop()
+	assert.GreaterOrEqual(t, calls.Load(), int32(2))
+}
+
+func TestSpoolSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	var calls atomic.Int32
+	cfg := Config{
+		Threads:    1,
+		Logger:     testutil.NewTestLogger(),
+		HTTPClient: sequenceClient(&calls, nil, 200),
+		Spool:      SpoolConfig{Dir: dir, ReplayInterval: 10 * time.Millisecond},
+	}
+
+	// Not started: the queue overflows, and the
+	// queued jobs are spooled on Stop.
+	r, err := NewRemote(cfg)
+	require.NoError(t, err)
+	for range cap(r.jobs) + 5 {
+		r.Upload(newJob("test"))
+	}
+	r.Stop()
+	require.Len(t, r.spool.entries(), cap(r.jobs)+5)
+	assert.Equal(t, int32(0), calls.Load())
+
+	r, err = NewRemote(cfg)
+	require.NoError(t, err)
+	r.Start()
+	defer r.Stop()
+	require.Eventually(t, func() bool { return len(r.spool.entries()) == 0 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(cap(r.jobs)+5), calls.Load())
+}
@@ -8,11 +8,32 @@ type Format string
 
 const FormatPprof Format = "pprof"
 
+// Profile names identify the kind of profile an UploadJob carries.
+// They match the __name__ label of the Pyroscope push API.
+const (
+	ProfileNameCPU            = "process_cpu"
+	ProfileNameMemory         = "memory"
+	ProfileNameGoroutine      = "goroutine"
+	ProfileNameGoroutineLeak  = "goroutineleak"
+	ProfileNameMutex          = "mutex"
+	ProfileNameBlock          = "block"
+	ProfileNameWall           = "wall"
+	ProfileNameThreadCreate   = "threadcreate"
+	ProfileNameRuntimeMetrics = "runtime_metrics"
+)
+
 type Upstream interface {
 	Upload(job *UploadJob)
 	Flush()
 }
 
+// Lifecycle is implemented by upstreams that need to be started
+// before the first upload, and stopped once profiling is stopped.
+type Lifecycle interface {
+	Start()
+	Stop()
+}
+
 type SampleType struct {
 	Units       string `json:"units,omitempty"`
 	Aggregation string `json:"aggregation,omitempty"`
@@ -34,4 +55,11 @@ type UploadJob struct {
 	// Deprecated
 	PrevProfile      []byte
 	SampleTypeConfig map[string]*SampleType
+	// ProfileName is the kind of the profile, one of the ProfileName* constants.
+	ProfileName string
+	// Labels is the label set of the profile series, including the
+	// application name under the __name__ key. Name holds the normalized
+	// string representation of the same label set, which is unable to
+	// represent some label values.
+	Labels map[string]string
 }
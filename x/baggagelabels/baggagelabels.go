@@ -0,0 +1,171 @@
+// Package baggagelabels provides HTTP and gRPC middleware making
+// OpenTelemetry baggage members profiling labels, so that the profiles
+// of a request can be filtered by the tenant, feature or experiment it
+// belongs to.
+//
+// Server-side middleware read the baggage from the request, client-side
+// middleware from the context of the outgoing call. The labels are set on
+// the calling goroutine for the duration of the call, and propagated
+// with the context.
+package baggagelabels
+
+import (
+	"context"
+	"net/http"
+	"runtime/pprof"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// Config specifies which baggage members are converted to labels, and how.
+type Config struct {
+	// Keys lists the baggage keys converted to labels.
+	Keys []string
+	// Prefixes lists the prefixes of the baggage keys converted to labels.
+	// If neither Keys nor Prefixes are specified, no members are converted,
+	// as baggage is set by the callers and every label adds series to the
+	// profiles. An empty prefix converts all the members.
+	Prefixes []string
+	// Rename returns the label name for a baggage key; members it returns
+	// an empty name for are skipped. By default, characters that are not
+	// allowed in label names are replaced with underscores.
+	Rename func(key string) string
+	// MaxValueLength limits the length of label values in bytes; longer
+	// values are truncated. Zero means no limit.
+	MaxValueLength int
+	// MaxLabels limits the number of labels; members are taken in the
+	// order of their keys. Zero means no limit.
+	MaxLabels int
+}
+
+// Middleware converts baggage to profiling labels.
+type Middleware struct {
+	cfg Config
+}
+
+func New(cfg Config) *Middleware {
+	if cfg.Rename == nil {
+		cfg.Rename = DefaultRename
+	}
+
+	return &Middleware{cfg: cfg}
+}
+
+// DefaultRename replaces characters other than ASCII letters,
+// digits and underscores with underscores.
+func DefaultRename(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+
+		return '_'
+	}, key)
+}
+
+// Labels returns the labels the baggage is converted to,
+// and false if there are none.
+func (m *Middleware) Labels(b baggage.Baggage) (pprof.LabelSet, bool) {
+	members := b.Members()
+	slices.SortFunc(members, func(a, b baggage.Member) int { return strings.Compare(a.Key(), b.Key()) })
+	pairs := make([]string, 0, 2*len(members))
+	for _, member := range members {
+		if m.cfg.MaxLabels > 0 && len(pairs) == 2*m.cfg.MaxLabels {
+			break
+		}
+		if member.Value() == "" || !m.matches(member.Key()) {
+			continue
+		}
+		name := m.cfg.Rename(member.Key())
+		if name == "" {
+			continue
+		}
+		pairs = append(pairs, name, truncate(member.Value(), m.cfg.MaxValueLength))
+	}
+	if len(pairs) == 0 {
+		return pprof.LabelSet{}, false
+	}
+
+	return pprof.Labels(pairs...), true
+}
+
+func (m *Middleware) matches(key string) bool {
+	if slices.Contains(m.cfg.Keys, key) {
+		return true
+	}
+
+	return slices.ContainsFunc(m.cfg.Prefixes, func(p string) bool { return strings.HasPrefix(key, p) })
+}
+
+func truncate(s string, n int) string {
+	if n <= 0 || len(s) <= n {
+		return s
+	}
+	s = s[:n]
+	for len(s) > 0 {
+		if r, size := utf8.DecodeLastRuneInString(s); r != utf8.RuneError || size > 1 {
+			break
+		}
+		s = s[:len(s)-1]
+	}
+
+	return s
+}
+
+// withLabels calls fn with the labels of the baggage set on the context and
+// the calling goroutine, or with ctx unchanged if there are no labels.
+func (m *Middleware) withLabels(ctx context.Context, b baggage.Baggage, fn func(context.Context)) {
+	labels, ok := m.Labels(b)
+	if !ok {
+		fn(ctx)
+
+		return
+	}
+	// Inlined version of pprof.Do to reduce noise in the stack trace.
+	defer pprof.SetGoroutineLabels(ctx)
+	ctx = pprof.WithLabels(ctx, labels)
+	pprof.SetGoroutineLabels(ctx)
+	fn(ctx)
+}
+
+// Handler returns an HTTP handler labeling requests with the baggage of
+// the request context, or of the Baggage header if the context has none;
+// in the latter case, the baggage is added to the request context.
+func (m *Middleware) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		b := baggage.FromContext(ctx)
+		if b.Len() == 0 {
+			if b, _ = baggage.Parse(r.Header.Get("Baggage")); b.Len() > 0 {
+				ctx = baggage.ContextWithBaggage(ctx, b)
+			}
+		}
+		m.withLabels(ctx, b, func(ctx context.Context) {
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+}
+
+// Transport returns an HTTP round tripper labeling outgoing requests with
+// the baggage of the request context. If rt is nil, http.DefaultTransport
+// is used.
+func (m *Middleware) Transport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	return roundTripperFunc(func(r *http.Request) (resp *http.Response, err error) {
+		m.withLabels(r.Context(), baggage.FromContext(r.Context()), func(ctx context.Context) {
+			resp, err = rt.RoundTrip(r.WithContext(ctx))
+		})
+
+		return resp, err
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
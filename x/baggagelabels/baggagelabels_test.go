@@ -0,0 +1,173 @@
+package baggagelabels
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/baggage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const testBaggage = "tenant=acme,feature.flag=new-ui,experiment=exp%201,session=abc"
+
+func labelsOf(ctx context.Context) map[string]string {
+	m := make(map[string]string)
+	pprof.ForLabels(ctx, func(k, v string) bool {
+		m[k] = v
+
+		return true
+	})
+
+	return m
+}
+
+func TestLabels(t *testing.T) {
+	b, err := baggage.Parse(testBaggage)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		expected map[string]string
+	}{
+		{
+			name: "all members",
+			cfg:  Config{Prefixes: []string{""}},
+			expected: map[string]string{
+				"tenant": "acme", "feature_flag": "new-ui", "experiment": "exp 1", "session": "abc",
+			},
+		},
+		{
+			name:     "keys and prefixes",
+			cfg:      Config{Keys: []string{"tenant", "experiment"}, Prefixes: []string{"feature."}},
+			expected: map[string]string{"tenant": "acme", "feature_flag": "new-ui", "experiment": "exp 1"},
+		},
+		{
+			name: "rename",
+			cfg: Config{
+				Keys: []string{"tenant", "session"},
+				Rename: func(key string) string {
+					if key == "session" {
+						return ""
+					}
+
+					return "baggage_" + key
+				},
+			},
+			expected: map[string]string{"baggage_tenant": "acme"},
+		},
+		{
+			name:     "limits",
+			cfg:      Config{Prefixes: []string{""}, MaxLabels: 2, MaxValueLength: 3},
+			expected: map[string]string{"experiment": "exp", "feature_flag": "new"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels, ok := New(tt.cfg).Labels(b)
+			require.True(t, ok)
+			ctx := pprof.WithLabels(context.Background(), labels)
+			assert.Equal(t, tt.expected, labelsOf(ctx))
+		})
+	}
+
+	_, ok := New(Config{Keys: []string{"missing"}}).Labels(b)
+	assert.False(t, ok)
+	_, ok = New(Config{}).Labels(b)
+	assert.False(t, ok, "no members are converted without keys or prefixes")
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "abc", truncate("abc", 0))
+	assert.Equal(t, "ab", truncate("abc", 2))
+	assert.Equal(t, "a", truncate("aé", 2))
+}
+
+func TestHandler(t *testing.T) {
+	m := New(Config{Keys: []string{"tenant"}})
+	var called bool
+	h := m.Handler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		called = true
+		assert.Equal(t, map[string]string{"tenant": "acme"}, labelsOf(r.Context()))
+		assert.Equal(t, "acme", baggage.FromContext(r.Context()).Member("tenant").Value())
+	}))
+	r := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+	r.Header.Set("Baggage", testBaggage)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	require.True(t, called)
+}
+
+func TestTransport(t *testing.T) {
+	m := New(Config{Keys: []string{"tenant"}})
+	rt := m.Transport(roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		assert.Equal(t, map[string]string{"tenant": "acme"}, labelsOf(r.Context()))
+
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}))
+	b, err := baggage.Parse(testBaggage)
+	require.NoError(t, err)
+	ctx := baggage.ContextWithBaggage(context.Background(), b)
+	r := httptest.NewRequest(http.MethodGet, "http://example.com", nil).WithContext(ctx)
+	resp, err := rt.RoundTrip(r)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestServerInterceptors(t *testing.T) {
+	m := New(Config{Prefixes: []string{"feature."}})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("baggage", testBaggage))
+	expected := map[string]string{"feature_flag": "new-ui"}
+
+	resp, err := m.UnaryServerInterceptor()(ctx, "req", &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req any) (any, error) {
+			assert.Equal(t, expected, labelsOf(ctx))
+
+			return strings.ToUpper(req.(string)), nil //nolint:forcetypeassert
+		})
+	require.NoError(t, err)
+	assert.Equal(t, "REQ", resp)
+
+	var called bool
+	err = m.StreamServerInterceptor()(nil, &serverStream{ctx: ctx}, &grpc.StreamServerInfo{},
+		func(_ any, ss grpc.ServerStream) error {
+			called = true
+			assert.Equal(t, expected, labelsOf(ss.Context()))
+
+			return nil
+		})
+	require.NoError(t, err)
+	assert.True(t, called)
+}
+
+func TestClientInterceptors(t *testing.T) {
+	m := New(Config{Keys: []string{"tenant"}})
+	b, err := baggage.Parse(testBaggage)
+	require.NoError(t, err)
+	ctx := baggage.ContextWithBaggage(context.Background(), b)
+	expected := map[string]string{"tenant": "acme"}
+
+	err = m.UnaryClientInterceptor()(ctx, "/svc/Method", nil, nil, nil,
+		func(ctx context.Context, _ string, _, _ any, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+			assert.Equal(t, expected, labelsOf(ctx))
+
+			return nil
+		})
+	require.NoError(t, err)
+
+	_, err = m.StreamClientInterceptor()(ctx, &grpc.StreamDesc{}, nil, "/svc/Method",
+		func(
+			ctx context.Context, _ *grpc.StreamDesc, _ *grpc.ClientConn, _ string, _ ...grpc.CallOption,
+		) (grpc.ClientStream, error) {
+			assert.Equal(t, expected, labelsOf(ctx))
+
+			return nil, nil
+		})
+	require.NoError(t, err)
+}
@@ -0,0 +1,94 @@
+package baggagelabels
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/baggage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// UnaryServerInterceptor labels calls with the baggage of the context, or
+// of the baggage metadata if the context has none; in the latter case, the
+// baggage is added to the context.
+func (m *Middleware) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		ctx, b := incomingBaggage(ctx)
+		m.withLabels(ctx, b, func(ctx context.Context) {
+			resp, err = handler(ctx, req)
+		})
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor labels streams like UnaryServerInterceptor.
+func (m *Middleware) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx, b := incomingBaggage(ss.Context())
+		m.withLabels(ctx, b, func(ctx context.Context) {
+			err = handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		})
+
+		return err
+	}
+}
+
+// UnaryClientInterceptor labels outgoing calls with the baggage of the context.
+func (m *Middleware) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) (err error) {
+		m.withLabels(ctx, baggage.FromContext(ctx), func(ctx context.Context) {
+			err = invoker(ctx, method, req, reply, cc, opts...)
+		})
+
+		return err
+	}
+}
+
+// StreamClientInterceptor labels the creation of outgoing
+// streams with the baggage of the context.
+func (m *Middleware) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (cs grpc.ClientStream, err error) {
+		m.withLabels(ctx, baggage.FromContext(ctx), func(ctx context.Context) {
+			cs, err = streamer(ctx, desc, cc, method, opts...)
+		})
+
+		return cs, err
+	}
+}
+
+func incomingBaggage(ctx context.Context) (context.Context, baggage.Baggage) {
+	if b := baggage.FromContext(ctx); b.Len() > 0 {
+		return ctx, b
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("baggage"); len(v) > 0 {
+		if b, _ := baggage.Parse(v[0]); b.Len() > 0 {
+			return baggage.ContextWithBaggage(ctx, b), b
+		}
+	}
+
+	return ctx, baggage.Baggage{}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+
+	ctx context.Context //nolint:containedctx
+}
+
+func (s *serverStream) Context() context.Context { return s.ctx }
@@ -6,6 +6,8 @@ toolchain go1.25.13
 
 replace github.com/grafana/pyroscope-go => ../../
 
+replace github.com/grafana/pyroscope-go/godeltaprof => ../../godeltaprof
+
 require (
 	github.com/grafana/pyroscope-go v1.4.0
 	github.com/grpc-ecosystem/go-grpc-middleware/v2 v2.3.3
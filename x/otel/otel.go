@@ -0,0 +1,113 @@
+// Package otel links OpenTelemetry traces with profiles: samples collected
+// while a root span is active are labeled with the span ID, which lets
+// Grafana navigate from a trace to the flame graph of its spans.
+package otel
+
+import (
+	"context"
+	"runtime/pprof"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+const (
+	// ProfileIDSpanAttributeKey is the span attribute holding the ID
+	// the profile samples of the span are labeled with.
+	ProfileIDSpanAttributeKey = "pyroscope.profile.id"
+
+	SpanIDLabelName   = "span_id"
+	SpanNameLabelName = "span_name"
+)
+
+type config struct {
+	rootOnly      bool
+	spanNameLabel bool
+}
+
+// Option configures the TracerProvider.
+type Option func(*config)
+
+// WithAllSpans makes all the spans started with the tracers labeled, not
+// only the local root spans. Labeling nested spans increases the overhead
+// and the cardinality of the profiles.
+func WithAllSpans() Option {
+	return func(c *config) { c.rootOnly = false }
+}
+
+// WithoutSpanName disables the span_name label, for applications where
+// span names are of high cardinality.
+func WithoutSpanName() Option {
+	return func(c *config) { c.spanNameLabel = false }
+}
+
+// TracerProvider wraps a trace.TracerProvider, so that spans started
+// with its tracers set the pprof labels of the calling goroutine.
+type TracerProvider struct {
+	embedded.TracerProvider
+
+	tp     trace.TracerProvider
+	config config
+}
+
+// NewTracerProvider wraps tp. By default only local root spans, that
+// is spans without a parent or with a remote parent, are labeled.
+func NewTracerProvider(tp trace.TracerProvider, options ...Option) *TracerProvider {
+	p := &TracerProvider{
+		tp:     tp,
+		config: config{rootOnly: true, spanNameLabel: true},
+	}
+	for _, o := range options {
+		o(&p.config)
+	}
+
+	return p
+}
+
+func (p *TracerProvider) Tracer(name string, options ...trace.TracerOption) trace.Tracer {
+	return &tracer{tr: p.tp.Tracer(name, options...), config: p.config}
+}
+
+type tracer struct {
+	embedded.Tracer
+
+	tr     trace.Tracer
+	config config
+}
+
+func (t *tracer) Start(
+	ctx context.Context,
+	name string,
+	options ...trace.SpanStartOption,
+) (context.Context, trace.Span) {
+	parent := trace.SpanContextFromContext(ctx)
+	spanCtx, span := t.tr.Start(ctx, name, options...)
+	sc := span.SpanContext()
+	if !sc.IsValid() || (t.config.rootOnly && parent.IsValid() && !parent.IsRemote()) {
+		return spanCtx, span
+	}
+
+	spanID := sc.SpanID().String()
+	labels := []string{SpanIDLabelName, spanID}
+	if t.config.spanNameLabel {
+		labels = append(labels, SpanNameLabelName, name)
+	}
+	spanCtx = pprof.WithLabels(spanCtx, pprof.Labels(labels...))
+	pprof.SetGoroutineLabels(spanCtx)
+	span.SetAttributes(attribute.String(ProfileIDSpanAttributeKey, spanID))
+
+	return spanCtx, &profileSpan{Span: span, parent: ctx}
+}
+
+// profileSpan restores the goroutine labels when the span ends.
+type profileSpan struct {
+	trace.Span
+
+	parent context.Context
+}
+
+func (s *profileSpan) End(options ...trace.SpanEndOption) {
+	s.Span.End(options...)
+	pprof.SetGoroutineLabels(s.parent)
+}
@@ -0,0 +1,55 @@
+package otel
+
+import (
+	"context"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracerProvider(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := NewTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	tr := tp.Tracer("test")
+
+	ctx, root := tr.Start(context.Background(), "root")
+	spanID := root.SpanContext().SpanID().String()
+	assertLabel(t, ctx, SpanIDLabelName, spanID)
+	assertLabel(t, ctx, SpanNameLabelName, "root")
+
+	// Nested spans inherit the labels of the root span.
+	childCtx, child := tr.Start(ctx, "child")
+	assertLabel(t, childCtx, SpanIDLabelName, spanID)
+	child.End()
+	root.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Empty(t, spans[0].Attributes())
+	assert.Equal(t, []attribute.KeyValue{attribute.String(ProfileIDSpanAttributeKey, spanID)}, spans[1].Attributes())
+}
+
+func TestTracerProviderAllSpans(t *testing.T) {
+	tp := NewTracerProvider(sdktrace.NewTracerProvider(), WithAllSpans(), WithoutSpanName())
+	tr := tp.Tracer("test")
+
+	ctx, root := tr.Start(context.Background(), "root")
+	defer root.End()
+	ctx, child := tr.Start(ctx, "child")
+	defer child.End()
+	assertLabel(t, ctx, SpanIDLabelName, child.SpanContext().SpanID().String())
+	_, ok := pprof.Label(ctx, SpanNameLabelName)
+	assert.False(t, ok)
+}
+
+func assertLabel(t *testing.T, ctx context.Context, key, expected string) {
+	t.Helper()
+	v, ok := pprof.Label(ctx, key)
+	require.True(t, ok)
+	assert.Equal(t, expected, v)
+}
@@ -0,0 +1,99 @@
+// Package otelmetrics reports the Pyroscope SDK metrics
+// with the OpenTelemetry metrics API.
+package otelmetrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/grafana/pyroscope-go/metrics"
+)
+
+const instrumentationName = "github.com/grafana/pyroscope-go"
+
+// Metrics implements metrics.Metrics with OpenTelemetry instruments.
+type Metrics struct {
+	meter metric.Meter
+}
+
+// New creates Metrics reporting with a meter of mp; if mp is nil,
+// the global meter provider is used.
+func New(mp metric.MeterProvider) *Metrics {
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+
+	return &Metrics{meter: mp.Meter(instrumentationName)}
+}
+
+func (m *Metrics) Counter(d metrics.Desc) metrics.Counter {
+	c, err := m.meter.Float64Counter(d.Name, metric.WithDescription(d.Help))
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return counter{c, d.Labels}
+}
+
+func (m *Metrics) Histogram(d metrics.Desc) metrics.Histogram {
+	opts := []metric.Float64HistogramOption{metric.WithDescription(d.Help)}
+	if len(d.Buckets) > 0 {
+		opts = append(opts, metric.WithExplicitBucketBoundaries(d.Buckets...))
+	}
+	h, err := m.meter.Float64Histogram(d.Name, opts...)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return histogram{h, d.Labels}
+}
+
+func (m *Metrics) Gauge(d metrics.Desc) metrics.Gauge {
+	g, err := m.meter.Float64Gauge(d.Name, metric.WithDescription(d.Help))
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return gauge{g, d.Labels}
+}
+
+func attributes(names, values []string) metric.MeasurementOption {
+	kvs := make([]attribute.KeyValue, 0, len(names))
+	for i, name := range names {
+		if i < len(values) {
+			kvs = append(kvs, attribute.String(name, values[i]))
+		}
+	}
+
+	return metric.WithAttributes(kvs...)
+}
+
+type counter struct {
+	c      metric.Float64Counter
+	labels []string
+}
+
+func (c counter) Add(v float64, labelValues ...string) {
+	c.c.Add(context.Background(), v, attributes(c.labels, labelValues))
+}
+
+type histogram struct {
+	h      metric.Float64Histogram
+	labels []string
+}
+
+func (h histogram) Observe(v float64, labelValues ...string) {
+	h.h.Record(context.Background(), v, attributes(h.labels, labelValues))
+}
+
+type gauge struct {
+	g      metric.Float64Gauge
+	labels []string
+}
+
+func (g gauge) Set(v float64, labelValues ...string) {
+	g.g.Record(context.Background(), v, attributes(g.labels, labelValues))
+}
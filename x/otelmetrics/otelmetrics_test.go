@@ -0,0 +1,46 @@
+package otelmetrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/grafana/pyroscope-go/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	m := New(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	m.Counter(metrics.Uploads).Add(1, "process_cpu", metrics.ResultSuccess, "https://example.com")
+	m.Counter(metrics.Uploads).Add(2, "process_cpu", metrics.ResultSuccess, "https://example.com")
+	m.Histogram(metrics.UploadDuration).Observe(0.5, "process_cpu", "https://example.com")
+	m.Gauge(metrics.QueueLength).Set(3, "https://example.com")
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	got := make(map[string]metricdata.Aggregation)
+	for _, md := range rm.ScopeMetrics[0].Metrics {
+		got[md.Name] = md.Data
+	}
+	require.Len(t, got, 3)
+
+	sum, ok := got[metrics.Uploads.Name].(metricdata.Sum[float64])
+	require.True(t, ok)
+	require.Len(t, sum.DataPoints, 1)
+	assert.InDelta(t, 3.0, sum.DataPoints[0].Value, 0)
+	v, _ := sum.DataPoints[0].Attributes.Value(attribute.Key(metrics.LabelResult))
+	assert.Equal(t, metrics.ResultSuccess, v.AsString())
+	v, _ = sum.DataPoints[0].Attributes.Value(attribute.Key(metrics.LabelDestination))
+	assert.Equal(t, "https://example.com", v.AsString())
+
+	hist, ok := got[metrics.UploadDuration.Name].(metricdata.Histogram[float64])
+	require.True(t, ok)
+	require.Len(t, hist.DataPoints, 1)
+	assert.Equal(t, metrics.UploadDuration.Buckets, hist.DataPoints[0].Bounds)
+}
@@ -0,0 +1,97 @@
+// Package prommetrics reports the Pyroscope SDK metrics
+// with the Prometheus client library.
+package prommetrics
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/grafana/pyroscope-go/metrics"
+)
+
+// Metrics implements metrics.Metrics with Prometheus collectors registered
+// with a Registerer. It can be shared by multiple profilers.
+type Metrics struct {
+	reg prometheus.Registerer
+
+	mu         sync.Mutex
+	collectors map[string]prometheus.Collector
+}
+
+// New creates Metrics registering collectors with reg; if reg
+// is nil, prometheus.DefaultRegisterer is used.
+func New(reg prometheus.Registerer) *Metrics {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	return &Metrics{
+		reg:        reg,
+		collectors: make(map[string]prometheus.Collector),
+	}
+}
+
+func (m *Metrics) Counter(d metrics.Desc) metrics.Counter {
+	c := m.register(d.Name, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: d.Name,
+		Help: d.Help,
+	}, d.Labels))
+
+	return counter{c.(*prometheus.CounterVec)} //nolint:forcetypeassert
+}
+
+func (m *Metrics) Histogram(d metrics.Desc) metrics.Histogram {
+	c := m.register(d.Name, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    d.Name,
+		Help:    d.Help,
+		Buckets: d.Buckets,
+	}, d.Labels))
+
+	return histogram{c.(*prometheus.HistogramVec)} //nolint:forcetypeassert
+}
+
+func (m *Metrics) Gauge(d metrics.Desc) metrics.Gauge {
+	c := m.register(d.Name, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: d.Name,
+		Help: d.Help,
+	}, d.Labels))
+
+	return gauge{c.(*prometheus.GaugeVec)} //nolint:forcetypeassert
+}
+
+// register registers the collector, unless a collector with the same
+// name is registered already, in which case the existing one is returned.
+func (m *Metrics) register(name string, c prometheus.Collector) prometheus.Collector {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.collectors[name]; ok {
+		return existing
+	}
+	if err := m.reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			// The metric is still usable, but not exported.
+			return c
+		}
+		c = are.ExistingCollector
+	}
+	m.collectors[name] = c
+
+	return c
+}
+
+type counter struct{ v *prometheus.CounterVec }
+
+func (c counter) Add(v float64, labelValues ...string) { c.v.WithLabelValues(labelValues...).Add(v) }
+
+type histogram struct{ v *prometheus.HistogramVec }
+
+func (h histogram) Observe(v float64, labelValues ...string) {
+	h.v.WithLabelValues(labelValues...).Observe(v)
+}
+
+type gauge struct{ v *prometheus.GaugeVec }
+
+func (g gauge) Set(v float64, labelValues ...string) { g.v.WithLabelValues(labelValues...).Set(v) }
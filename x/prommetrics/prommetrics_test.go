@@ -0,0 +1,32 @@
+package prommetrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/pyroscope-go/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := New(reg)
+	const dst = "https://example.com"
+	// Instruments are shared by all the users, such as upstreams.
+	m.Counter(metrics.Uploads).Add(1, "process_cpu", metrics.ResultSuccess, dst)
+	New(reg).Counter(metrics.Uploads).Add(2, "process_cpu", metrics.ResultSuccess, dst)
+	m.Histogram(metrics.UploadDuration).Observe(0.5, "process_cpu", dst)
+	m.Gauge(metrics.QueueLength).Set(3, dst)
+
+	n, err := testutil.GatherAndCount(reg)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	c := m.Counter(metrics.Uploads).(counter) //nolint:forcetypeassert
+	assert.InDelta(t, 3.0, testutil.ToFloat64(c.v.WithLabelValues("process_cpu", metrics.ResultSuccess, dst)), 0)
+	g := m.Gauge(metrics.QueueLength).(gauge) //nolint:forcetypeassert
+	assert.InDelta(t, 3.0, testutil.ToFloat64(g.v.WithLabelValues(dst)), 0)
+}